@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const GITHUB_HOST = "github.com"
+
+// GithubCopilotConfigFile is the format of hosts.json and apps.json. The keys
+// of hosts.json are hosts, the ones of apps.json are "<host>:<client id>".
+type GithubCopilotConfigFile map[string]GithubCopilotHost
+
+type GithubCopilotHost struct {
+	User        string `json:"user"`
+	OAuthToken  string `json:"oauth_token"`
+	GithubAppID string `json:"githubAppId,omitempty"`
+}
+
+// GithubAccount is a GitHub token found in the Copilot config files.
+type GithubAccount struct {
+	Host       string
+	User       string
+	OAuthToken string
+	// Source is the file the account was read from
+	Source string
+}
+
+func (a GithubAccount) String() string {
+	return firstNonEmpty(a.User, "unknown") + "@" + a.Host
+}
+
+// matches tells if the account is the one given with -account, either a user,
+// a host or user@host.
+func (a GithubAccount) matches(name string) bool {
+	return name == a.User || name == a.Host || name == a.User+"@"+a.Host
+}
+
+// endpoints are the Copilot APIs of the host of the account, the ones set
+// for the host in the config file take precedence.
+func (a GithubAccount) endpoints() CopilotEndpoints {
+	endpoints := appConfig.endpoints()
+
+	if a.Host != GITHUB_HOST {
+		copilot := "https://copilot-api." + a.Host
+
+		endpoints = CopilotEndpoints{
+			TokenURL:      githubAPI(a.Host) + "/copilot_internal/v2/token",
+			CompletionURL: copilot + "/chat/completions",
+			ModelsURL:     copilot + "/models",
+		}
+	}
+
+	return appConfig.Hosts[a.Host].override(endpoints)
+}
+
+// githubAPI is the REST API of a GitHub Enterprise host. Enterprise Cloud
+// hosts (<name>.ghe.com) have their own API subdomain.
+func githubAPI(host string) string {
+	if strings.HasSuffix(host, ".ghe.com") {
+		return "https://api." + host
+	}
+
+	return "https://" + host + "/api/v3"
+}
+
+// configDir is where the Copilot editor plugins keep their tokens.
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "github-copilot")
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".config", "github-copilot")
+}
+
+// configPath is the hosts.json written by the older Copilot plugins and by
+// gopilot login.
+func configPath() string {
+	return filepath.Join(configDir(), "hosts.json")
+}
+
+// appsPath is the apps.json written by the newer Copilot plugins.
+func appsPath() string {
+	return filepath.Join(configDir(), "apps.json")
+}
+
+func readConfigFile(path string) (GithubCopilotConfigFile, error) {
+	config := GithubCopilotConfigFile{}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return config, err
+	}
+
+	if err := json.Unmarshal(content, &config); err != nil {
+		return config, newError(ErrorConfigMissing, "cannot parse "+path, err)
+	}
+
+	return config, nil
+}
+
+// readAccounts lists the accounts of hosts.json and then the ones of
+// apps.json, a token found in both files is only listed once.
+func readAccounts() ([]GithubAccount, error) {
+	var accounts []GithubAccount
+
+	found := false
+	seen := map[string]bool{}
+
+	for _, path := range []string{configPath(), appsPath()} {
+		config, err := readConfigFile(path)
+
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		found = true
+
+		keys := make([]string, 0, len(config))
+
+		for key := range config {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			entry := config[key]
+			host := key
+
+			if path == appsPath() {
+				if i := strings.LastIndex(key, ":"); i > 0 {
+					host = key[:i]
+				}
+			}
+
+			if entry.OAuthToken == "" || seen[host+entry.OAuthToken] {
+				continue
+			}
+
+			seen[host+entry.OAuthToken] = true
+
+			accounts = append(accounts, GithubAccount{Host: host, User: entry.User, OAuthToken: entry.OAuthToken, Source: path})
+		}
+	}
+
+	if !found {
+		return nil, newError(ErrorConfigMissing, fmt.Sprintf("cannot read %s or %s, run gopilot login", configPath(), appsPath()), os.ErrNotExist)
+	}
+
+	return accounts, nil
+}
+
+// readAccount returns the account given with -account, or the first
+// github.com one when name is empty.
+func readAccount(name string) (GithubAccount, error) {
+	accounts, err := readAccounts()
+
+	if err != nil {
+		return GithubAccount{}, err
+	}
+
+	if len(accounts) == 0 {
+		return GithubAccount{}, newError(ErrorConfigMissing, "no oauth_token in "+configDir()+", run gopilot login", nil)
+	}
+
+	if name == "" {
+		for _, account := range accounts {
+			if account.Host == GITHUB_HOST {
+				return account, nil
+			}
+		}
+
+		return accounts[0], nil
+	}
+
+	names := make([]string, len(accounts))
+
+	for i, account := range accounts {
+		if account.matches(name) {
+			return account, nil
+		}
+
+		names[i] = account.String()
+	}
+
+	return GithubAccount{}, newError(ErrorConfigMissing, fmt.Sprintf("no account %q, the available ones are %s", name, strings.Join(names, ", ")), nil)
+}
+
+// accountEndpoints are the endpoints of the account, or the configured ones
+// when the account cannot be read yet.
+func accountEndpoints(name string) (CopilotEndpoints, error) {
+	account, err := readAccount(name)
+
+	if err != nil {
+		if name != "" {
+			return CopilotEndpoints{}, err
+		}
+
+		return appConfig.endpoints(), nil
+	}
+
+	return account.endpoints(), nil
+}
+
+// newAccountProvider talks to the Copilot APIs of the host of the account.
+func newAccountProvider(name string) (*CopilotProvider, error) {
+	endpoints, err := accountEndpoints(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewCopilotProvider(endpoints)
+	provider.request.Account = name
+
+	return provider, nil
+}
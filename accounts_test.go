@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const TEST_HOSTS = `{
+	"github.com": {"user": "octocat", "oauth_token": "gho_hosts"},
+	"acme.ghe.com": {"user": "octocat-acme", "oauth_token": "gho_acme"}
+}`
+
+const TEST_APPS = `{
+	"github.com:Iv1.b507a08c87ecfe98": {"user": "octocat", "oauth_token": "gho_hosts", "githubAppId": "Iv1.b507a08c87ecfe98"},
+	"github.com:Iv23ctfURkiMfJ4xr5mv": {"user": "hubot", "oauth_token": "gho_apps", "githubAppId": "Iv23ctfURkiMfJ4xr5mv"}
+}`
+
+func TestReadAccounts(t *testing.T) {
+	setConfigHome(t)
+
+	writeTestConfig(t, "hosts.json", TEST_HOSTS)
+	writeTestConfig(t, "apps.json", TEST_APPS)
+
+	accounts, err := readAccounts()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+
+	for _, account := range accounts {
+		got = append(got, account.String())
+	}
+
+	// The github.com token of both files is listed once
+	want := "octocat-acme@acme.ghe.com octocat@github.com hubot@github.com"
+
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %s want %s", strings.Join(got, " "), want)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"", "gho_hosts"},
+		{"hubot", "gho_apps"},
+		{"acme.ghe.com", "gho_acme"},
+		{"octocat@github.com", "gho_hosts"},
+	}
+
+	for _, tt := range tests {
+		account, err := readAccount(tt.name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if account.OAuthToken != tt.token {
+			t.Errorf("got %s want %s", account.OAuthToken, tt.token)
+		}
+	}
+
+	_, err = readAccount("nobody")
+
+	if !errors.Is(err, &ProviderError{Kind: ErrorConfigMissing}) || !strings.Contains(err.Error(), "hubot@github.com") {
+		t.Errorf("got %v want the available accounts", err)
+	}
+}
+
+func TestReadAccountsApps(t *testing.T) {
+	setConfigHome(t)
+
+	// Only the apps.json of the newer plugins, under $XDG_CONFIG_HOME
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(t.TempDir(), "config"))
+
+	writeTestConfig(t, "apps.json", TEST_APPS)
+
+	account, err := readAccount("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.OAuthToken != "gho_hosts" || account.Source != appsPath() {
+		t.Errorf("got %s from %s want %s from %s", account.OAuthToken, account.Source, "gho_hosts", appsPath())
+	}
+}
+
+func TestAccountEndpoints(t *testing.T) {
+	previous := appConfig
+
+	t.Cleanup(func() { appConfig = previous })
+
+	// The Copilot API of the Enterprise Server host is set in the config file
+	appConfig.Hosts = map[string]APIConfig{
+		"ghes.example.com": {CompletionURL: "https://copilot.example.com/chat/completions"},
+	}
+
+	tests := []struct {
+		host  string
+		token string
+		chat  string
+		user  string
+	}{
+		{GITHUB_HOST, COPILOT_TOKEN_API, COPILOT_COMPLETION_API, GITHUB_USER_API},
+		{"acme.ghe.com", "https://api.acme.ghe.com/copilot_internal/v2/token", "https://copilot-api.acme.ghe.com/chat/completions", "https://api.acme.ghe.com/user"},
+		{"github.example.com", "https://github.example.com/api/v3/copilot_internal/v2/token", "https://copilot-api.github.example.com/chat/completions", "https://github.example.com/api/v3/user"},
+		{"ghes.example.com", "https://ghes.example.com/api/v3/copilot_internal/v2/token", "https://copilot.example.com/chat/completions", "https://ghes.example.com/api/v3/user"},
+	}
+
+	for _, tt := range tests {
+		endpoints := GithubAccount{Host: tt.host}.endpoints()
+
+		if endpoints.TokenURL != tt.token {
+			t.Errorf("got %s want %s", endpoints.TokenURL, tt.token)
+		}
+
+		if endpoints.CompletionURL != tt.chat {
+			t.Errorf("got %s want %s", endpoints.CompletionURL, tt.chat)
+		}
+
+		if got := githubEndpoints(tt.host).UserURL; got != tt.user {
+			t.Errorf("got %s want %s", got, tt.user)
+		}
+	}
+}
+
+func TestNewProviderAccount(t *testing.T) {
+	setConfigHome(t)
+
+	writeTestConfig(t, "hosts.json", TEST_HOSTS)
+
+	provider, err := newProvider(ProviderConfig{Name: "copilot", Account: "octocat-acme"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copilot := provider.(*CopilotProvider)
+
+	if copilot.request.Endpoints.TokenURL != "https://api.acme.ghe.com/copilot_internal/v2/token" {
+		t.Errorf("got %s want the acme.ghe.com token API", copilot.request.Endpoints.TokenURL)
+	}
+
+	if _, err := newProvider(ProviderConfig{Name: "copilot", Account: "nobody"}); err == nil {
+		t.Errorf("got nil want an error")
+	}
+
+	// Without an account the missing config is reported by the first request
+	setConfigHome(t)
+
+	if _, err := newProvider(ProviderConfig{Name: "copilot"}); err != nil {
+		t.Errorf("got %v want nil", err)
+	}
+}
+
+func TestCopilotProviderAccount(t *testing.T) {
+	setConfigHome(t)
+
+	writeTestConfig(t, "hosts.json", `{"github.com":{"user":"octocat","oauth_token":"gho_other"}}`)
+	writeTestConfig(t, "apps.json", `{"github.com:Iv1.x":{"user":"hubot","oauth_token":"`+FAKE_OAUTH_TOKEN+`"}}`)
+
+	fake := NewFakeCopilot(t)
+
+	provider := NewCopilotProvider(fake.Endpoints())
+	provider.request.Account = "hubot"
+
+	completion, err := provider.Send(context.Background(), []HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if completion.Content != "hello" {
+		t.Errorf("got %s want %s", completion.Content, "hello")
+	}
+}
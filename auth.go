@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// GITHUB_CLIENT_ID is the OAuth app of the Copilot editor plugins, its tokens
+// are accepted by the Copilot token API.
+const GITHUB_CLIENT_ID = "Iv1.b507a08c87ecfe98"
+const GITHUB_DEVICE_CODE_URL = "https://github.com/login/device/code"
+const GITHUB_ACCESS_TOKEN_URL = "https://github.com/login/oauth/access_token"
+const GITHUB_USER_API = "https://api.github.com/user"
+
+// SLOW_DOWN_INTERVAL is added to the polling interval when GitHub asks for it.
+const SLOW_DOWN_INTERVAL = 5 * time.Second
+
+// GithubEndpoints are the URLs of the GitHub OAuth device flow. They can be
+// pointed to a local server, for instance in tests.
+type GithubEndpoints struct {
+	DeviceCodeURL  string
+	AccessTokenURL string
+	UserURL        string
+}
+
+var DefaultGithubEndpoints = GithubEndpoints{
+	DeviceCodeURL:  GITHUB_DEVICE_CODE_URL,
+	AccessTokenURL: GITHUB_ACCESS_TOKEN_URL,
+	UserURL:        GITHUB_USER_API,
+}
+
+type DeviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+type AccessTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	Interval         int    `json:"interval"`
+}
+
+type GithubUser struct {
+	Login string `json:"login"`
+}
+
+func runLogin(args []string) error {
+	flags := flag.NewFlagSet("login", flag.ExitOnError)
+	config := configFlag(flags)
+	host := flags.String("host", GITHUB_HOST, "GitHub host, for instance a GitHub Enterprise one")
+
+	flags.Parse(args)
+
+	if err := useConfig(*config); err != nil {
+		return err
+	}
+
+	return login(context.Background(), *host, githubEndpoints(*host), os.Stdout)
+}
+
+func runLogout(args []string) error {
+	flags := flag.NewFlagSet("logout", flag.ExitOnError)
+	host := flags.String("host", GITHUB_HOST, "GitHub host to log out of")
+
+	flags.Parse(args)
+
+	return logout(*host, os.Stdout)
+}
+
+func runStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	config := configFlag(flags)
+	account := flags.String("account", os.Getenv("COPILOT_ACCOUNT"), "Account to check, a user, a host or user@host")
+
+	flags.Parse(args)
+
+	if err := useConfig(*config); err != nil {
+		return err
+	}
+
+	endpoints, _ := accountEndpoints(*account)
+
+	return status(*account, endpoints, os.Stdout)
+}
+
+// githubEndpoints are the device flow URLs of a GitHub host.
+func githubEndpoints(host string) GithubEndpoints {
+	if host == GITHUB_HOST {
+		return DefaultGithubEndpoints
+	}
+
+	return GithubEndpoints{
+		DeviceCodeURL:  "https://" + host + "/login/device/code",
+		AccessTokenURL: "https://" + host + "/login/oauth/access_token",
+		UserURL:        githubAPI(host) + "/user",
+	}
+}
+
+// login runs the OAuth device flow and saves the GitHub token to hosts.json.
+func login(ctx context.Context, host string, endpoints GithubEndpoints, w io.Writer) error {
+	code, err := requestDeviceCode(ctx, endpoints)
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "First copy your one-time code: %s\n", code.UserCode)
+	fmt.Fprintf(w, "Then open %s and enter it.\n", code.VerificationURI)
+	fmt.Fprintln(w, "Waiting for the authorization...")
+
+	token, err := pollAccessToken(ctx, endpoints, code)
+
+	if err != nil {
+		return err
+	}
+
+	user, err := fetchUser(ctx, endpoints, token)
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeConfig(host, GithubCopilotHost{User: user.Login, OAuthToken: token}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Logged in to %s as %s\n", host, user.Login)
+
+	return nil
+}
+
+// logout removes the token of host from hosts.json, the other hosts are kept.
+// The tokens in apps.json belong to the editor plugins and are left alone.
+func logout(host string, w io.Writer) error {
+	hosts, err := readConfigFile(configPath())
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if _, ok := hosts[host]; !ok {
+		fmt.Fprintf(w, "Not logged in to %s\n", host)
+
+		return nil
+	}
+
+	delete(hosts, host)
+
+	if len(hosts) == 0 {
+		err = os.Remove(configPath())
+	} else {
+		err = writeConfigFile(configPath(), hosts)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Logged out of %s\n", host)
+
+	return nil
+}
+
+// status prints the logged in user and checks the token with the Copilot
+// token API. The other accounts are listed so one can be picked.
+func status(name string, endpoints CopilotEndpoints, w io.Writer) error {
+	account, err := readAccount(name)
+
+	if err != nil {
+		fmt.Fprintln(w, "Not logged in, run gopilot login")
+
+		return err
+	}
+
+	fmt.Fprintf(w, "Logged in to %s as %s (%s)\n", account.Host, firstNonEmpty(account.User, "an unknown user"), filepath.Base(account.Source))
+
+	accounts, _ := readAccounts()
+
+	var others []string
+
+	for _, other := range accounts {
+		if other != account {
+			others = append(others, other.String())
+		}
+	}
+
+	if len(others) > 0 {
+		fmt.Fprintf(w, "Other accounts, pick one with -account: %s\n", strings.Join(others, ", "))
+	}
+
+	token, err := getToken(context.Background(), name, endpoints.TokenURL)
+
+	if err != nil {
+		fmt.Fprintln(w, "The Copilot token cannot be fetched")
+
+		return err
+	}
+
+	expiration := time.Unix(extractExpiration(token), 0)
+
+	fmt.Fprintf(w, "Copilot token valid until %s (%s left)\n", expiration.Format(time.DateTime), time.Until(expiration).Round(time.Minute))
+
+	return nil
+}
+
+func requestDeviceCode(ctx context.Context, endpoints GithubEndpoints) (DeviceCodeResponse, error) {
+	var code DeviceCodeResponse
+
+	form := url.Values{"client_id": {GITHUB_CLIENT_ID}, "scope": {"read:user"}}
+
+	err := postForm(ctx, endpoints.DeviceCodeURL, form, &code)
+
+	if err != nil {
+		return code, err
+	}
+
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return code, newError(ErrorAuthFailed, "GitHub returned no device code", nil)
+	}
+
+	return code, nil
+}
+
+// pollAccessToken waits until the user enters the code, GitHub answers
+// authorization_pending until then.
+func pollAccessToken(ctx context.Context, endpoints GithubEndpoints, code DeviceCodeResponse) (string, error) {
+	interval := time.Duration(code.Interval) * time.Second
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+	defer cancel()
+
+	form := url.Values{
+		"client_id":   {GITHUB_CLIENT_ID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", newError(ErrorAuthFailed, "the code expired, run gopilot login again", nil)
+			}
+
+			return "", ctx.Err()
+		case <-time.After(interval):
+		}
+
+		var response AccessTokenResponse
+
+		if err := postForm(ctx, endpoints.AccessTokenURL, form, &response); err != nil {
+			return "", err
+		}
+
+		switch response.Error {
+		case "":
+			if response.AccessToken == "" {
+				return "", newError(ErrorAuthFailed, "GitHub returned an empty token", nil)
+			}
+
+			return response.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += SLOW_DOWN_INTERVAL
+
+			if response.Interval > 0 {
+				interval = time.Duration(response.Interval) * time.Second
+			}
+		case "expired_token":
+			return "", newError(ErrorAuthFailed, "the code expired, run gopilot login again", nil)
+		case "access_denied":
+			return "", newError(ErrorAuthFailed, "the authorization was denied", nil)
+		default:
+			return "", newError(ErrorAuthFailed, firstNonEmpty(response.ErrorDescription, response.Error), nil)
+		}
+	}
+}
+
+func fetchUser(ctx context.Context, endpoints GithubEndpoints, token string) (GithubUser, error) {
+	var user GithubUser
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoints.UserURL, nil)
+
+	if err != nil {
+		return user, err
+	}
+
+	req.Header.Set("authorization", "token "+token)
+	req.Header.Set("accept", "application/json")
+
+	client := &http.Client{Timeout: appConfig.Timeouts.Request, Transport: httpTransport}
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return user, newError(ErrorNetwork, "cannot reach the GitHub API", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return user, newError(ErrorAuthFailed, "GitHub API returned "+resp.Status, nil)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return user, newError(ErrorAuthFailed, "cannot decode the GitHub user", err)
+	}
+
+	return user, nil
+}
+
+func postForm(ctx context.Context, endpoint string, form url.Values, response interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("content-type", "application/x-www-form-urlencoded")
+	req.Header.Set("accept", "application/json")
+
+	client := &http.Client{Timeout: appConfig.Timeouts.Request, Transport: httpTransport}
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return newError(ErrorNetwork, "cannot reach GitHub", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return newError(ErrorAuthFailed, "GitHub returned "+resp.Status, nil)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return newError(ErrorAuthFailed, "cannot decode the GitHub response", err)
+	}
+
+	return nil
+}
+
+func writeConfigFile(path string, config GithubCopilotConfigFile) error {
+	content, err := json.MarshalIndent(config, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, content, 0600)
+}
+
+// writeConfig saves the token of host to hosts.json, in the format written by
+// the Copilot editor plugins.
+func writeConfig(host string, entry GithubCopilotHost) error {
+	hosts, err := readConfigFile(configPath())
+
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	hosts[host] = entry
+
+	return writeConfigFile(configPath(), hosts)
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FakeGithub is a local stand-in for the GitHub device flow. The token is
+// issued after Pending polls, or the poll answers Error.
+type FakeGithub struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	Pending int
+	Error   string
+	Polls   int
+	Forms   []string
+}
+
+func NewFakeGithub(t *testing.T) *FakeGithub {
+	f := &FakeGithub{}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/login/device/code", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(DeviceCodeResponse{
+			DeviceCode:      "device",
+			UserCode:        "ABCD-1234",
+			VerificationURI: "https://github.com/login/device",
+			ExpiresIn:       60,
+		})
+	})
+
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		r.ParseForm()
+
+		f.Polls++
+		f.Forms = append(f.Forms, r.Form.Encode())
+
+		switch {
+		case f.Error != "":
+			json.NewEncoder(w).Encode(AccessTokenResponse{Error: f.Error})
+		case f.Polls <= f.Pending:
+			json.NewEncoder(w).Encode(AccessTokenResponse{Error: "authorization_pending"})
+		default:
+			json.NewEncoder(w).Encode(AccessTokenResponse{AccessToken: FAKE_OAUTH_TOKEN, TokenType: "bearer"})
+		}
+	})
+
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("authorization") != "token "+FAKE_OAUTH_TOKEN {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		json.NewEncoder(w).Encode(GithubUser{Login: "octocat"})
+	})
+
+	f.Server = httptest.NewServer(mux)
+
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *FakeGithub) Endpoints() GithubEndpoints {
+	return GithubEndpoints{
+		DeviceCodeURL:  f.URL + "/login/device/code",
+		AccessTokenURL: f.URL + "/login/oauth/access_token",
+		UserURL:        f.URL + "/user",
+	}
+}
+
+func TestLogin(t *testing.T) {
+	setConfigHome(t)
+
+	// Other hosts in hosts.json are kept
+	writeTestConfig(t, "hosts.json", `{"ghe.example.com":{"user":"me","oauth_token":"other"}}`)
+
+	github := NewFakeGithub(t)
+	github.Pending = 2
+
+	var output bytes.Buffer
+
+	if err := login(context.Background(), GITHUB_HOST, github.Endpoints(), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.String(), "ABCD-1234") || !strings.Contains(output.String(), "as octocat") {
+		t.Errorf("got %s want the code and the user", output.String())
+	}
+
+	if github.Polls != 3 {
+		t.Errorf("got %d want %d", github.Polls, 3)
+	}
+
+	if !strings.Contains(github.Forms[0], "device_code=device") {
+		t.Errorf("got %s want the device code", github.Forms[0])
+	}
+
+	account, err := readAccount("")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.User != "octocat" || account.OAuthToken != FAKE_OAUTH_TOKEN {
+		t.Errorf("got %s %s want %s %s", account.User, account.OAuthToken, "octocat", FAKE_OAUTH_TOKEN)
+	}
+
+	hosts, _ := readConfigFile(configPath())
+
+	if _, ok := hosts["ghe.example.com"]; !ok {
+		t.Errorf("The other hosts were removed")
+	}
+
+	info, _ := os.Stat(configPath())
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got %o want %o", info.Mode().Perm(), 0600)
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	tests := []struct {
+		error string
+		want  string
+	}{
+		{"access_denied", "the authorization was denied"},
+		{"expired_token", "the code expired, run gopilot login again"},
+		{"unsupported_grant_type", "unsupported_grant_type"},
+	}
+
+	for _, tt := range tests {
+		setConfigHome(t)
+
+		github := NewFakeGithub(t)
+		github.Error = tt.error
+
+		err := login(context.Background(), GITHUB_HOST, github.Endpoints(), &bytes.Buffer{})
+
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v want %s", err, tt.want)
+		}
+
+		if _, err := os.Stat(configPath()); err == nil {
+			t.Errorf("hosts.json was written")
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	writeHostsFile(t)
+
+	var output bytes.Buffer
+
+	if err := logout(GITHUB_HOST, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != "Logged out of github.com\n" {
+		t.Errorf("got %s want %s", output.String(), "Logged out of github.com\n")
+	}
+
+	if _, err := os.Stat(configPath()); !os.IsNotExist(err) {
+		t.Errorf("got %v want hosts.json removed", err)
+	}
+
+	output.Reset()
+
+	if err := logout(GITHUB_HOST, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != "Not logged in to github.com\n" {
+		t.Errorf("got %s want %s", output.String(), "Not logged in to github.com\n")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	writeHostsFile(t)
+
+	copilot := NewFakeCopilot(t)
+
+	var output bytes.Buffer
+
+	if err := status("", copilot.Endpoints(), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(output.String(), "as octocat") || !strings.Contains(output.String(), "Copilot token valid until") {
+		t.Errorf("got %s want the user and the token validity", output.String())
+	}
+
+	// A GitHub token without a Copilot seat
+	copilot.TokenStatus = http.StatusForbidden
+	output.Reset()
+
+	err := status("", copilot.Endpoints(), &output)
+
+	if err == nil || !strings.Contains(err.Error(), "no Copilot seat") {
+		t.Errorf("got %v want no Copilot seat", err)
+	}
+}
+
+func TestStatusLoggedOut(t *testing.T) {
+	setConfigHome(t)
+
+	var output bytes.Buffer
+
+	if err := status("", NewFakeCopilot(t).Endpoints(), &output); err == nil {
+		t.Errorf("got nil want an error")
+	}
+
+	if output.String() != "Not logged in, run gopilot login\n" {
+		t.Errorf("got %s want %s", output.String(), "Not logged in, run gopilot login\n")
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var previewStyle = lipgloss.NewStyle().
+	BorderLeft(true).
+	BorderStyle(lipgloss.NormalBorder()).
+	BorderForeground(lipgloss.Color("8"))
+
+type sessionItem struct {
+	session Session
+}
+
+func (i sessionItem) Title() string       { return i.session.Title }
+func (i sessionItem) Description() string { return i.session.UpdatedAt.Format("2006-01-02 15:04") }
+
+func (i sessionItem) FilterValue() string { return i.session.Title }
+
+// matches tells whether the title or a message of the conversation contains
+// the lowercase term. The greeting is skipped, every session starts with it.
+func (i sessionItem) matches(term string) bool {
+	if strings.Contains(strings.ToLower(i.session.Title), term) {
+		return true
+	}
+
+	for _, message := range i.session.Messages {
+		if message.Role != "user" && message.Role != "assistant" || message.Content == GREETING {
+			continue
+		}
+
+		if strings.Contains(strings.ToLower(message.Content), term) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sessionFilter replaces the fuzzy filter, which matches almost every session
+// once the content is included, with a case-insensitive substring search. The
+// targets are the titles of the items, in the same order.
+func sessionFilter(items []list.Item) list.FilterFunc {
+	return func(term string, targets []string) []list.Rank {
+		term = strings.ToLower(term)
+
+		var ranks []list.Rank
+
+		for i, target := range targets {
+			if i >= len(items) || !items[i].(sessionItem).matches(term) {
+				continue
+			}
+
+			// Highlight the term when it is in the title, the indexes are runes
+			var matched []int
+
+			title := strings.ToLower(target)
+
+			if start := strings.Index(title, term); start >= 0 {
+				first := utf8.RuneCountInString(title[:start])
+
+				for j := 0; j < utf8.RuneCountInString(term); j++ {
+					matched = append(matched, first+j)
+				}
+			}
+
+			ranks = append(ranks, list.Rank{Index: i, MatchedIndexes: matched})
+		}
+
+		return ranks
+	}
+}
+
+type browserMode int
+
+const (
+	browsing browserMode = iota
+	renaming
+	deleting
+)
+
+type browserKeyMap struct {
+	Open   key.Binding
+	Rename key.Binding
+	Delete key.Binding
+	Close  key.Binding
+	Yes    key.Binding
+	No     key.Binding
+	Accept key.Binding
+	Cancel key.Binding
+}
+
+var browserKeys = browserKeyMap{
+	Open: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "open"),
+	),
+	Rename: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "rename"),
+	),
+	Delete: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "delete"),
+	),
+	Close: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "back to chat"),
+	),
+	Yes: key.NewBinding(
+		key.WithKeys("y"),
+	),
+	No: key.NewBinding(
+		key.WithKeys("n", "esc"),
+	),
+	Accept: key.NewBinding(
+		key.WithKeys("enter"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc"),
+	),
+}
+
+// browser lists the saved sessions next to a preview of the selected one.
+type browser struct {
+	list      list.Model
+	preview   viewport.Model
+	input     textinput.Model
+	mode      browserMode
+	previewID string
+	width     int
+	height    int
+}
+
+func newBrowser(sessions []Session, width int, height int) browser {
+	items := make([]list.Item, len(sessions))
+
+	for i, session := range sessions {
+		items[i] = sessionItem{session: session}
+	}
+
+	sessionList := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	sessionList.Title = "Sessions"
+	sessionList.Filter = sessionFilter(items)
+	sessionList.SetStatusBarItemName("session", "sessions")
+	sessionList.DisableQuitKeybindings()
+	sessionList.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{browserKeys.Open, browserKeys.Rename, browserKeys.Delete, browserKeys.Close}
+	}
+
+	input := textinput.New()
+	input.Prompt = "Rename: "
+	input.CharLimit = SESSION_TITLE_LENGTH
+
+	b := browser{
+		list:    sessionList,
+		preview: viewport.New(0, 0),
+		input:   input,
+	}
+
+	b.setSize(width, height)
+
+	return b
+}
+
+func (b *browser) setSize(width int, height int) {
+	b.width = width
+	b.height = height
+
+	listWidth := width * 2 / 5
+	previewWidth := width - listWidth - previewStyle.GetHorizontalFrameSize()
+
+	b.list.SetSize(listWidth, height-1)
+
+	b.preview.Width = previewWidth
+	b.preview.Height = height - 1
+
+	// Force the preview to be rendered again with the new width
+	b.previewID = ""
+	b.updatePreview()
+}
+
+func (b *browser) selected() (Session, bool) {
+	item, ok := b.list.SelectedItem().(sessionItem)
+
+	return item.session, ok
+}
+
+func (b *browser) updatePreview() {
+	session, ok := b.selected()
+
+	if !ok {
+		b.previewID = ""
+		b.preview.SetContent("")
+
+		return
+	}
+
+	if session.ID == b.previewID {
+		return
+	}
+
+	b.previewID = session.ID
+	b.preview.SetContent(renderMessages(session.Messages, b.preview.Width))
+	b.preview.GotoTop()
+}
+
+// replaceSession swaps the session with the given id, or removes it when
+// session is nil. The items are looked up by id because the list indexes are
+// relative to the filtered items.
+func (b *browser) replaceSession(id string, session *Session) tea.Cmd {
+	items := make([]list.Item, 0, len(b.list.Items()))
+
+	for _, item := range b.list.Items() {
+		if item.(sessionItem).session.ID != id {
+			items = append(items, item)
+
+			continue
+		}
+
+		if session != nil {
+			items = append(items, sessionItem{session: *session})
+		}
+	}
+
+	b.previewID = ""
+	b.list.Filter = sessionFilter(items)
+
+	return b.list.SetItems(items)
+}
+
+func (b browser) View() string {
+	footer := ""
+
+	switch b.mode {
+	case renaming:
+		footer = b.input.View()
+	case deleting:
+		session, _ := b.selected()
+		footer = errorStyle.Render("Delete \"" + session.Title + "\"? (y/n)")
+	}
+
+	content := lipgloss.JoinHorizontal(
+		lipgloss.Top,
+		b.list.View(),
+		previewStyle.Render(b.preview.View()),
+	)
+
+	return lipgloss.JoinVertical(lipgloss.Left, content, footer)
+}
+
+// updateBrowser handles the messages while the session browser is open.
+func (m model) updateBrowser(msg tea.Msg) (model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	keyMsg, isKey := msg.(tea.KeyMsg)
+
+	if isKey && key.Matches(keyMsg, m.keys.Quit) {
+		return m, tea.Quit
+	}
+
+	switch {
+	case isKey && m.browser.mode == renaming:
+		return m.updateRename(keyMsg)
+
+	case isKey && m.browser.mode == deleting:
+		return m.updateDelete(keyMsg)
+
+	case isKey && m.browser.list.FilterState() != list.Filtering:
+		switch {
+		case key.Matches(keyMsg, browserKeys.Close):
+			if m.browser.list.FilterState() == list.FilterApplied {
+				m.browser.list.ResetFilter()
+				m.browser.updatePreview()
+
+				return m, nil
+			}
+
+			m.browsing = false
+
+			return m, nil
+
+		case key.Matches(keyMsg, browserKeys.Open):
+			if session, ok := m.browser.selected(); ok {
+				m.browsing = false
+
+				return m.resumeSession(session), nil
+			}
+
+			return m, nil
+
+		case key.Matches(keyMsg, browserKeys.Rename):
+			if session, ok := m.browser.selected(); ok {
+				m.browser.mode = renaming
+				m.browser.input.SetValue(session.Title)
+				m.browser.input.CursorEnd()
+
+				return m, m.browser.input.Focus()
+			}
+
+			return m, nil
+
+		case key.Matches(keyMsg, browserKeys.Delete):
+			if _, ok := m.browser.selected(); ok {
+				m.browser.mode = deleting
+			}
+
+			return m, nil
+		}
+	}
+
+	m.browser.list, cmd = m.browser.list.Update(msg)
+	m.browser.updatePreview()
+
+	return m, cmd
+}
+
+func (m model) updateRename(msg tea.KeyMsg) (model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch {
+	case key.Matches(msg, browserKeys.Cancel):
+		m.browser.mode = browsing
+		m.browser.input.Blur()
+
+		return m, nil
+
+	case key.Matches(msg, browserKeys.Accept):
+		m.browser.mode = browsing
+		m.browser.input.Blur()
+
+		title := strings.TrimSpace(m.browser.input.Value())
+		session, ok := m.browser.selected()
+
+		if !ok || title == "" {
+			return m, nil
+		}
+
+		session.Title = title
+
+		if err := saveSession(session); err != nil {
+			return m, m.browser.list.NewStatusMessage(errorStyle.Render(err.Error()))
+		}
+
+		if session.ID == m.session.ID {
+			m.session.Title = title
+		}
+
+		return m, m.browser.replaceSession(session.ID, &session)
+	}
+
+	m.browser.input, cmd = m.browser.input.Update(msg)
+
+	return m, cmd
+}
+
+func (m model) updateDelete(msg tea.KeyMsg) (model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, browserKeys.No):
+		m.browser.mode = browsing
+
+	case key.Matches(msg, browserKeys.Yes):
+		m.browser.mode = browsing
+
+		session, ok := m.browser.selected()
+
+		if !ok {
+			break
+		}
+
+		if err := deleteSession(session.ID); err != nil {
+			return m, m.browser.list.NewStatusMessage(errorStyle.Render(err.Error()))
+		}
+
+		// Keep the conversation on screen but stop saving it over the deleted file
+		if session.ID == m.session.ID {
+			params := m.session.Params
+			m.session = newSession()
+			m.session.Params = params
+		}
+
+		cmd := m.browser.replaceSession(session.ID, nil)
+		m.browser.updatePreview()
+
+		return m, cmd
+	}
+
+	return m, nil
+}
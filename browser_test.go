@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestSessionFilter(t *testing.T) {
+	sessions := []Session{
+		{Title: "Slices", Messages: []HistoryMessage{
+			createBotHistoryEntry(GREETING),
+			createHistoryEntry("How do I reverse a slice?"),
+			createErrorHistoryEntry("network error"),
+		}},
+		{Title: "Containers", Messages: []HistoryMessage{
+			createBotHistoryEntry(GREETING),
+			createHistoryEntry("Write a Docker compose file"),
+		}},
+	}
+
+	items := make([]list.Item, len(sessions))
+	targets := make([]string, len(sessions))
+
+	for i, session := range sessions {
+		items[i] = sessionItem{session: session}
+		targets[i] = items[i].FilterValue()
+	}
+
+	tests := []struct {
+		term string
+		want []int
+	}{
+		{"reverse", []int{0}},
+		{"DOCKER", []int{1}},
+		{"slice", []int{0}},
+		// Fuzzy matches, the greeting and the errors are not searched
+		{"rust", nil},
+		{"assist", nil},
+		{"network", nil},
+	}
+
+	for _, tt := range tests {
+		var got []int
+
+		for _, rank := range sessionFilter(items)(tt.term, targets) {
+			got = append(got, rank.Index)
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("got %v want %v for %s", got, tt.want, tt.term)
+		}
+	}
+
+	ranks := sessionFilter(items)("lice", targets)
+
+	if len(ranks) != 1 || fmt.Sprint(ranks[0].MatchedIndexes) != "[1 2 3 4]" {
+		t.Errorf("got %v want the title highlighted", ranks)
+	}
+}
+
+func runeKey(r string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(r)}
+}
+
+func TestBrowser(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	for i, id := range []string{"first", "second", "third"} {
+		session := Session{
+			ID:        id,
+			Title:     id,
+			UpdatedAt: time.Now().Add(time.Duration(i) * time.Minute),
+			Messages:  []HistoryMessage{createHistoryEntry("question " + id)},
+			History:   []HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("question " + id)},
+		}
+
+		if err := saveSession(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := initialModel(&FakeProvider{})
+	m.width = 80
+	m.height = 24
+
+	update := func(msg tea.Msg) {
+		updated, _ := m.Update(msg)
+		m = updated.(model)
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyCtrlO})
+
+	if !m.browsing {
+		t.Fatalf("Browser not open")
+	}
+
+	if len(m.browser.list.Items()) != 3 {
+		t.Fatalf("got %d want %d", len(m.browser.list.Items()), 3)
+	}
+
+	// The most recent session is selected first
+	update(runeKey("d"))
+	update(runeKey("y"))
+
+	if _, err := loadSession("third"); err == nil {
+		t.Errorf("Session was not deleted")
+	}
+
+	if len(m.browser.list.Items()) != 2 {
+		t.Errorf("got %d want %d", len(m.browser.list.Items()), 2)
+	}
+
+	update(runeKey("r"))
+	m.browser.input.SetValue("renamed")
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	session, err := loadSession("second")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if session.Title != "renamed" {
+		t.Errorf("got %s want %s", session.Title, "renamed")
+	}
+
+	update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	if m.browsing {
+		t.Errorf("Browser still open")
+	}
+
+	if m.session.ID != "second" || m.history[1].Content != "question second" {
+		t.Errorf("got %s want %s", m.session.ID, "second")
+	}
+}
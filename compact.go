@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const COMPACT_PROMPT = `You summarize programming conversations so they can continue with less context.
+Write a concise summary of the conversation below for yourself, not for the user.
+Keep the goals of the user, the decisions made, the code, names, versions, commands and errors that matter, and the open questions.
+Drop greetings, repetitions and anything that was superseded. Use markdown.`
+
+const COMPACT_REQUEST = "Summarize the conversation above."
+
+// SUMMARY_PREFIX starts the system message that replaces the compacted turns.
+const SUMMARY_PREFIX = "Summary of the earlier conversation:\n\n"
+
+// COMPACT_KEEP_TURNS is how many of the latest turns are kept as they are.
+const COMPACT_KEEP_TURNS = 2
+
+type CompactedMsg struct {
+	request   int
+	summary   string
+	compacted int
+}
+
+func createCompactedEntry(compacted int) HistoryMessage {
+	return HistoryMessage{
+		Content: fmt.Sprintf("%d earlier messages compacted into a summary", compacted),
+		Role:    "compacted",
+	}
+}
+
+func isSummary(message HistoryMessage) bool {
+	return message.Role == "system" && strings.HasPrefix(message.Content, SUMMARY_PREFIX)
+}
+
+// splitForCompaction separates the system prompt, the turns to summarize and
+// the latest turns that are kept. Previous summaries are summarized again.
+func splitForCompaction(history []HistoryMessage) (system []HistoryMessage, old []HistoryMessage, recent []HistoryMessage) {
+	start := 0
+
+	for start < len(history) && history[start].Role == "system" && !isSummary(history[start]) {
+		start++
+	}
+
+	end := len(history)
+
+	for turns := 0; turns < COMPACT_KEEP_TURNS && end > start; {
+		end--
+
+		if history[end].Role == "user" {
+			turns++
+		}
+	}
+
+	return history[:start], history[start:end], history[end:]
+}
+
+// summaryHistory is the request asking for the summary of old, trimmed to the
+// budget of the model if needed.
+func summaryHistory(old []HistoryMessage, budget int) []HistoryMessage {
+	history := []HistoryMessage{createSystemHistoryEntry(COMPACT_PROMPT)}
+
+	// The conversation is given as a transcript so the model does not follow it
+	var transcript strings.Builder
+
+	for _, message := range old {
+		role := message.Role
+
+		if isSummary(message) {
+			role = "summary"
+		}
+
+		fmt.Fprintf(&transcript, "%s:\n%s\n\n", role, message.Content)
+	}
+
+	history = append(history, createHistoryEntry(transcript.String()+COMPACT_REQUEST))
+
+	// A single message cannot be truncated by turns, keep its end instead
+	if historyTokens(history) > budget {
+		content := []rune(history[1].Content)
+		keep := max(budget-historyTokens(history[:1])-MESSAGE_OVERHEAD_TOKENS, 0) * 4
+
+		if keep < len(content) {
+			history[1].Content = string(content[len(content)-keep:])
+		}
+	}
+
+	return history
+}
+
+// summarize asks the provider for the summary of old.
+func summarize(ctx context.Context, provider Provider, old []HistoryMessage, budget int, request int) tea.Cmd {
+	return func() tea.Msg {
+		completion, err := provider.Send(ctx, summaryHistory(old, budget), func(string, bool, bool) {})
+
+		if errors.Is(err, context.Canceled) {
+			return CompactedMsg{request: request}
+		}
+
+		if err != nil {
+			return FailedMsg{request: request, err: err}
+		}
+
+		if strings.TrimSpace(completion.Content) == "" {
+			return FailedMsg{request: request, err: errors.New("the model returned an empty summary")}
+		}
+
+		return CompactedMsg{request: request, summary: completion.Content, compacted: len(old)}
+	}
+}
+
+// compact starts summarizing the older turns, the transcript is left intact.
+func (m model) compact() (model, tea.Cmd) {
+	if m.answering {
+		return m, nil
+	}
+
+	_, old, _ := splitForCompaction(m.history)
+
+	if len(old) == 0 {
+		return m, func() tea.Msg {
+			return ErrorMsg{err: fmt.Errorf("only the last %d turns are in the conversation, there is nothing to compact", COMPACT_KEEP_TURNS)}
+		}
+	}
+
+	m = m.fitParams()
+
+	m.answering = true
+	m.compacting = true
+	m.request++
+
+	m.messages = append(m.messages, createBotHistoryEntry("Compacting..."))
+	m.placeholder = len(m.messages) - 1
+
+	m.viewport.SetContent(renderMessages(m.messages, m.width))
+	m.viewport.GotoBottom()
+
+	if tunable, ok := m.provider.(Tunable); ok {
+		tunable.SetParams(m.session.Params.orDefault())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	budget := promptBudget(m.modelInfo(), m.session.Params.orDefault())
+
+	return m, summarize(ctx, m.provider, old, budget, m.request)
+}
+
+// compacted replaces the older turns of the history with the summary and
+// marks the place in the transcript.
+func (m model) compacted(msg CompactedMsg) (model, tea.Cmd) {
+	if !m.compacting || msg.request != m.request {
+		return m, nil
+	}
+
+	m.answering = false
+	m.compacting = false
+	m.cancel = nil
+
+	// Remove the "Compacting..." placeholder
+	m.messages = slices.Delete(m.messages, m.placeholder, m.placeholder+1)
+
+	if msg.compacted > 0 {
+		system, _, recent := splitForCompaction(m.history)
+
+		history := append([]HistoryMessage(nil), system...)
+		history = append(history, createSystemHistoryEntry(SUMMARY_PREFIX+msg.summary))
+
+		m.history = append(history, recent...)
+		m.messages = append(m.messages, createCompactedEntry(msg.compacted))
+	}
+
+	m.viewport.SetContent(renderMessages(m.messages, m.width))
+	m.viewport.GotoBottom()
+
+	if msg.compacted == 0 {
+		return m, nil
+	}
+
+	return m, m.persist()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func roles(history []HistoryMessage) []string {
+	var roles []string
+
+	for _, message := range history {
+		roles = append(roles, message.Role)
+	}
+
+	return roles
+}
+
+func TestSplitForCompaction(t *testing.T) {
+	summary := createSystemHistoryEntry(SUMMARY_PREFIX + "earlier")
+
+	tests := []struct {
+		history []HistoryMessage
+		system  int
+		old     int
+		recent  int
+	}{
+		{[]HistoryMessage{createSystemHistoryEntry("system")}, 1, 0, 0},
+		{[]HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("a"), createBotHistoryEntry("b")}, 1, 0, 2},
+		{
+			[]HistoryMessage{
+				createSystemHistoryEntry("system"),
+				createHistoryEntry("a"), createBotHistoryEntry("b"),
+				createHistoryEntry("c"), createBotHistoryEntry("d"),
+				createHistoryEntry("e"), createBotHistoryEntry("f"),
+			},
+			1, 2, 4,
+		},
+		// A previous summary is compacted again
+		{
+			[]HistoryMessage{
+				createSystemHistoryEntry("system"), summary,
+				createHistoryEntry("c"), createBotHistoryEntry("d"),
+				createHistoryEntry("e"), createBotHistoryEntry("f"),
+				createHistoryEntry("g"),
+			},
+			1, 3, 3,
+		},
+	}
+
+	for _, tt := range tests {
+		system, old, recent := splitForCompaction(tt.history)
+
+		if len(system) != tt.system || len(old) != tt.old || len(recent) != tt.recent {
+			t.Errorf("got %d/%d/%d want %d/%d/%d", len(system), len(old), len(recent), tt.system, tt.old, tt.recent)
+		}
+	}
+}
+
+func TestSummaryHistory(t *testing.T) {
+	old := []HistoryMessage{createHistoryEntry("how do I list files?"), createBotHistoryEntry("use ls")}
+
+	history := summaryHistory(old, 1000)
+
+	if history[0].Content != COMPACT_PROMPT {
+		t.Errorf("got %s want %s", history[0].Content, COMPACT_PROMPT)
+	}
+
+	want := "user:\nhow do I list files?\n\nassistant:\nuse ls\n\n" + COMPACT_REQUEST
+
+	if history[1].Content != want {
+		t.Errorf("got %s want %s", history[1].Content, want)
+	}
+
+	// The oldest part of the transcript is cut to fit the budget
+	old = append(old, createHistoryEntry(strings.Repeat("a", 4000)))
+
+	history = summaryHistory(old, 500)
+
+	if historyTokens(history) > 500 {
+		t.Errorf("got %d want at most %d", historyTokens(history), 500)
+	}
+
+	if !strings.HasSuffix(history[1].Content, COMPACT_REQUEST) {
+		t.Errorf("got %s want the request at the end", history[1].Content)
+	}
+}
+
+func compactableModel(provider Provider) model {
+	m := initialModel(provider)
+
+	for _, text := range []string{"a", "b", "c", "d", "e", "f"} {
+		m.history = append(m.history, createHistoryEntry(text), createBotHistoryEntry(text))
+		m.messages = append(m.messages, createHistoryEntry(text), createBotHistoryEntry(text))
+	}
+
+	return m
+}
+
+func TestUpdateCompact(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	provider := &FakeProvider{reply: "the summary"}
+	m := compactableModel(provider)
+	transcript := len(m.messages)
+
+	m, cmd := m.compact()
+
+	if !m.compacting || !m.answering {
+		t.Errorf("Not compacting")
+	}
+
+	if m.messages[len(m.messages)-1].Content != "Compacting..." {
+		t.Errorf("got %s want %s", m.messages[len(m.messages)-1].Content, "Compacting...")
+	}
+
+	msgs := cmdMessages(cmd)
+
+	if provider.history[0].Content != COMPACT_PROMPT {
+		t.Errorf("got %s want %s", provider.history[0].Content, COMPACT_PROMPT)
+	}
+
+	updated, _ := m.Update(msgs[0])
+	m = updated.(model)
+
+	if m.compacting || m.answering {
+		t.Errorf("Still compacting")
+	}
+
+	want := []string{"system", "system", "user", "assistant", "user", "assistant"}
+
+	if strings.Join(roles(m.history), " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", roles(m.history), want)
+	}
+
+	if m.history[1].Content != SUMMARY_PREFIX+"the summary" {
+		t.Errorf("got %s want %s", m.history[1].Content, SUMMARY_PREFIX+"the summary")
+	}
+
+	// The transcript is kept and the compaction is marked
+	if len(m.messages) != transcript+1 {
+		t.Errorf("got %d want %d", len(m.messages), transcript+1)
+	}
+
+	marker := m.messages[len(m.messages)-1]
+
+	if marker.Role != "compacted" || !strings.HasPrefix(marker.Content, "8 earlier messages") {
+		t.Errorf("got %s %s want the compaction marker", marker.Role, marker.Content)
+	}
+}
+
+func TestUpdateCompactNothing(t *testing.T) {
+	m := initialModel(&FakeProvider{reply: "the summary"})
+
+	m, cmd := m.compact()
+
+	if m.compacting {
+		t.Errorf("Compacting an empty conversation")
+	}
+
+	msgs := cmdMessages(cmd)
+
+	if _, ok := msgs[0].(ErrorMsg); !ok {
+		t.Errorf("got %T want %T", msgs[0], ErrorMsg{})
+	}
+}
+
+func TestUpdateCompactError(t *testing.T) {
+	m := compactableModel(&FakeProvider{err: errors.New("boom")})
+	history := len(m.history)
+	transcript := len(m.messages)
+
+	m, cmd := m.compact()
+
+	var updated tea.Model = m
+
+	for _, msg := range cmdMessages(cmd) {
+		updated, _ = updated.Update(msg)
+	}
+
+	m = updated.(model)
+
+	if m.compacting || m.answering {
+		t.Errorf("Still compacting")
+	}
+
+	if len(m.history) != history {
+		t.Errorf("got %d want %d", len(m.history), history)
+	}
+
+	// The placeholder is replaced by the error
+	if len(m.messages) != transcript+1 || m.messages[len(m.messages)-1].Role != "error" {
+		t.Errorf("got %v want the error after the transcript", roles(m.messages))
+	}
+}
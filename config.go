@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const MAX_INPUT_HEIGHT = 20
+
+// Config holds the defaults that can be changed with the config file and the
+// GOPILOT_* environment variables.
+type Config struct {
+	// Provider and Model are the defaults of -provider and -model, the model
+	// only applies to the provider it belongs to
+	Provider string         `toml:"provider"`
+	Model    string         `toml:"model"`
+	API      APIConfig      `toml:"api"`
+	Headers  HeadersConfig  `toml:"headers"`
+	Timeouts TimeoutsConfig `toml:"timeouts"`
+	UI       UIConfig       `toml:"ui"`
+	// Hosts overrides the APIs of the accounts of a GitHub host, the ones
+	// left empty are derived from the host
+	Hosts map[string]APIConfig `toml:"hosts"`
+}
+
+type APIConfig struct {
+	TokenURL      string `toml:"token_url"`
+	CompletionURL string `toml:"completion_url"`
+	ModelsURL     string `toml:"models_url"`
+}
+
+// HeadersConfig is the editor gopilot introduces itself as to Copilot.
+type HeadersConfig struct {
+	EditorVersion       string `toml:"editor_version"`
+	EditorPluginVersion string `toml:"editor_plugin_version"`
+	UserAgent           string `toml:"user_agent"`
+}
+
+type TimeoutsConfig struct {
+	// Request is the timeout of the token, models and GitHub requests
+	Request time.Duration `toml:"request"`
+	// Completion is how long to wait for a completion response and then for
+	// each of its chunks
+	Completion time.Duration `toml:"completion"`
+}
+
+type UIConfig struct {
+	CharLimit   int          `toml:"char_limit"`
+	InputHeight int          `toml:"input_height"`
+	Colors      ColorsConfig `toml:"colors"`
+}
+
+// ColorsConfig are ANSI color numbers or #rrggbb colors.
+type ColorsConfig struct {
+	User      string `toml:"user"`
+	Assistant string `toml:"assistant"`
+	Error     string `toml:"error"`
+}
+
+var DefaultConfig = Config{
+	API: APIConfig{
+		TokenURL:      DefaultCopilotEndpoints.TokenURL,
+		CompletionURL: DefaultCopilotEndpoints.CompletionURL,
+		ModelsURL:     DefaultCopilotEndpoints.ModelsURL,
+	},
+	Headers: HeadersConfig{
+		EditorVersion:       "vscode/1.88.0",
+		EditorPluginVersion: "copilot-chat/0.14.2024032901",
+		UserAgent:           "GitHubCopilotChat/0.14.2024032901",
+	},
+	Timeouts: TimeoutsConfig{
+		Request:    10 * time.Second,
+		Completion: 40 * time.Second,
+	},
+	UI: UIConfig{
+		CharLimit:   1000,
+		InputHeight: 4,
+		Colors: ColorsConfig{
+			User:      "6",
+			Assistant: "5",
+			Error:     "1",
+		},
+	},
+}
+
+// appConfig is the configuration in use, see useConfig.
+var appConfig = DefaultConfig
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// configFilePath is the config file read when --config is not given.
+func configFilePath() string {
+	return filepath.Join(gopilotConfigDir(), "config.toml")
+}
+
+// loadConfig reads the config file and then the environment variables. A
+// missing file is only an error when it was given explicitly.
+func loadConfig(path string) (Config, error) {
+	config := DefaultConfig
+	explicit := path != ""
+
+	if !explicit {
+		path = configFilePath()
+	}
+
+	content, err := os.ReadFile(path)
+
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	case err != nil:
+		return config, fmt.Errorf("cannot read the config file: %w", err)
+	default:
+		metadata, err := toml.Decode(string(content), &config)
+
+		if err != nil {
+			return config, fmt.Errorf("%s: %w", path, err)
+		}
+
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return config, fmt.Errorf("%s: unknown setting %s", path, undecoded[0])
+		}
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return config, err
+	}
+
+	if err := config.validate(); err != nil {
+		return config, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+type envVar struct {
+	name  string
+	value interface{}
+}
+
+func (c *Config) envVars() []envVar {
+	return []envVar{
+		{"GOPILOT_PROVIDER", &c.Provider},
+		{"GOPILOT_MODEL", &c.Model},
+		{"GOPILOT_TOKEN_URL", &c.API.TokenURL},
+		{"GOPILOT_COMPLETION_URL", &c.API.CompletionURL},
+		{"GOPILOT_MODELS_URL", &c.API.ModelsURL},
+		{"GOPILOT_EDITOR_VERSION", &c.Headers.EditorVersion},
+		{"GOPILOT_EDITOR_PLUGIN_VERSION", &c.Headers.EditorPluginVersion},
+		{"GOPILOT_USER_AGENT", &c.Headers.UserAgent},
+		{"GOPILOT_REQUEST_TIMEOUT", &c.Timeouts.Request},
+		{"GOPILOT_COMPLETION_TIMEOUT", &c.Timeouts.Completion},
+		{"GOPILOT_CHAR_LIMIT", &c.UI.CharLimit},
+		{"GOPILOT_INPUT_HEIGHT", &c.UI.InputHeight},
+		{"GOPILOT_USER_COLOR", &c.UI.Colors.User},
+		{"GOPILOT_ASSISTANT_COLOR", &c.UI.Colors.Assistant},
+		{"GOPILOT_ERROR_COLOR", &c.UI.Colors.Error},
+	}
+}
+
+// applyEnv overrides the settings with the environment variables that are set.
+func (c *Config) applyEnv() error {
+	for _, variable := range c.envVars() {
+		value, ok := os.LookupEnv(variable.name)
+
+		if !ok {
+			continue
+		}
+
+		switch target := variable.value.(type) {
+		case *string:
+			*target = value
+		case *int:
+			number, err := strconv.Atoi(value)
+
+			if err != nil {
+				return fmt.Errorf("%s must be a number, got %q", variable.name, value)
+			}
+
+			*target = number
+		case *time.Duration:
+			duration, err := time.ParseDuration(value)
+
+			if err != nil {
+				return fmt.Errorf("%s must be a duration like \"40s\", got %q", variable.name, value)
+			}
+
+			*target = duration
+		}
+	}
+
+	return nil
+}
+
+type setting[T any] struct {
+	key   string
+	value T
+}
+
+// validate reports every invalid setting, named as in the config file.
+func (c Config) validate() error {
+	var errs []error
+
+	if !slices.Contains(providerNames, firstNonEmpty(c.Provider, "copilot")) {
+		errs = append(errs, fmt.Errorf("provider must be one of %s, got %q", strings.Join(providerNames, ", "), c.Provider))
+	}
+
+	for _, endpoint := range []setting[string]{
+		{"api.token_url", c.API.TokenURL},
+		{"api.completion_url", c.API.CompletionURL},
+		{"api.models_url", c.API.ModelsURL},
+	} {
+		if !isHTTPURL(endpoint.value) {
+			errs = append(errs, fmt.Errorf("%s must be an http or https URL, got %q", endpoint.key, endpoint.value))
+		}
+	}
+
+	hosts := make([]string, 0, len(c.Hosts))
+
+	for host := range c.Hosts {
+		hosts = append(hosts, host)
+	}
+
+	slices.Sort(hosts)
+
+	for _, host := range hosts {
+		api := c.Hosts[host]
+
+		for _, endpoint := range []setting[string]{
+			{"token_url", api.TokenURL},
+			{"completion_url", api.CompletionURL},
+			{"models_url", api.ModelsURL},
+		} {
+			if endpoint.value != "" && !isHTTPURL(endpoint.value) {
+				errs = append(errs, fmt.Errorf("hosts.%q.%s must be an http or https URL, got %q", host, endpoint.key, endpoint.value))
+			}
+		}
+	}
+
+	for _, header := range []setting[string]{
+		{"headers.editor_version", c.Headers.EditorVersion},
+		{"headers.editor_plugin_version", c.Headers.EditorPluginVersion},
+		{"headers.user_agent", c.Headers.UserAgent},
+	} {
+		if strings.TrimSpace(header.value) == "" {
+			errs = append(errs, fmt.Errorf("%s cannot be empty", header.key))
+		}
+	}
+
+	for _, timeout := range []setting[time.Duration]{
+		{"timeouts.request", c.Timeouts.Request},
+		{"timeouts.completion", c.Timeouts.Completion},
+	} {
+		if timeout.value < time.Second {
+			errs = append(errs, fmt.Errorf("%s must be a duration of at least 1s like \"40s\", got %s", timeout.key, timeout.value))
+		}
+	}
+
+	if c.UI.CharLimit < 0 {
+		errs = append(errs, fmt.Errorf("ui.char_limit must be 0 (no limit) or more, got %d", c.UI.CharLimit))
+	}
+
+	if c.UI.InputHeight < 1 || c.UI.InputHeight > MAX_INPUT_HEIGHT {
+		errs = append(errs, fmt.Errorf("ui.input_height must be between 1 and %d, got %d", MAX_INPUT_HEIGHT, c.UI.InputHeight))
+	}
+
+	for _, color := range []setting[string]{
+		{"ui.colors.user", c.UI.Colors.User},
+		{"ui.colors.assistant", c.UI.Colors.Assistant},
+		{"ui.colors.error", c.UI.Colors.Error},
+	} {
+		if !isColor(color.value) {
+			errs = append(errs, fmt.Errorf("%s must be an ANSI color from 0 to 255 or #rrggbb, got %q", color.key, color.value))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func isColor(value string) bool {
+	if hexColor.MatchString(value) {
+		return true
+	}
+
+	number, err := strconv.Atoi(value)
+
+	return err == nil && number >= 0 && number <= 255
+}
+
+// modelFor returns the model of the config when it belongs to the provider.
+func (c Config) modelFor(provider string) string {
+	if firstNonEmpty(c.Provider, "copilot") != firstNonEmpty(provider, "copilot") {
+		return ""
+	}
+
+	return c.Model
+}
+
+// override replaces the endpoints that are set.
+func (a APIConfig) override(endpoints CopilotEndpoints) CopilotEndpoints {
+	return CopilotEndpoints{
+		TokenURL:      firstNonEmpty(a.TokenURL, endpoints.TokenURL),
+		CompletionURL: firstNonEmpty(a.CompletionURL, endpoints.CompletionURL),
+		ModelsURL:     firstNonEmpty(a.ModelsURL, endpoints.ModelsURL),
+	}
+}
+
+func (c Config) endpoints() CopilotEndpoints {
+	return CopilotEndpoints{
+		TokenURL:      c.API.TokenURL,
+		CompletionURL: c.API.CompletionURL,
+		ModelsURL:     c.API.ModelsURL,
+	}
+}
+
+// configFlag adds --config to the flags of a command.
+func configFlag(flags *flag.FlagSet) *string {
+	return flags.String("config", os.Getenv("GOPILOT_CONFIG"), "Config file, defaults to ~/.config/gopilot/config.toml or $GOPILOT_CONFIG")
+}
+
+// useConfig loads the config file given with --config, or the default one,
+// and applies it.
+func useConfig(path string) error {
+	config, err := loadConfig(path)
+
+	if err != nil {
+		return err
+	}
+
+	appConfig = config
+
+	senderStyle = senderStyle.Foreground(lipgloss.Color(config.UI.Colors.User))
+	botStyle = botStyle.Foreground(lipgloss.Color(config.UI.Colors.Assistant))
+	errorStyle = errorStyle.Foreground(lipgloss.Color(config.UI.Colors.Error))
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTOML(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	setConfigHome(t)
+
+	path := writeTOML(t, `
+provider = "ollama"
+model = "llama3"
+
+[api]
+completion_url = "http://localhost:4000/chat/completions"
+
+[headers]
+user_agent = "GitHubCopilotChat/0.20.0"
+
+[timeouts]
+completion = "2m"
+
+[ui]
+input_height = 6
+
+[ui.colors]
+user = "#ff8800"
+
+[hosts."ghes.example.com"]
+completion_url = "https://copilot.example.com/chat/completions"
+`)
+
+	t.Setenv("GOPILOT_INPUT_HEIGHT", "8")
+	t.Setenv("GOPILOT_REQUEST_TIMEOUT", "5s")
+
+	config, err := loadConfig(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := DefaultConfig
+	want.Provider = "ollama"
+	want.Model = "llama3"
+	want.API.CompletionURL = "http://localhost:4000/chat/completions"
+	want.Headers.UserAgent = "GitHubCopilotChat/0.20.0"
+	want.Timeouts.Completion = 2 * time.Minute
+	want.Timeouts.Request = 5 * time.Second
+	want.UI.InputHeight = 8
+	want.UI.Colors.User = "#ff8800"
+	want.Hosts = map[string]APIConfig{"ghes.example.com": {CompletionURL: "https://copilot.example.com/chat/completions"}}
+
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("got %+v want %+v", config, want)
+	}
+}
+
+func TestLoadConfigDefaultPath(t *testing.T) {
+	setConfigHome(t)
+
+	// No config file is fine unless one is given
+	config, err := loadConfig("")
+
+	if err != nil || !reflect.DeepEqual(config, DefaultConfig) {
+		t.Errorf("got %+v %v want the defaults", config, err)
+	}
+
+	if _, err := loadConfig(filepath.Join(t.TempDir(), "missing.toml")); err == nil {
+		t.Errorf("got nil want an error")
+	}
+
+	os.MkdirAll(gopilotConfigDir(), 0700)
+	os.WriteFile(configFilePath(), []byte("[ui]\nchar_limit = 0\n"), 0600)
+
+	config, err = loadConfig("")
+
+	if err != nil || config.UI.CharLimit != 0 {
+		t.Errorf("got %d %v want %d", config.UI.CharLimit, err, 0)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		content string
+		env     string
+		value   string
+		want    string
+	}{
+		{"[ui\n", "", "", "config.toml: toml: line 2"},
+		{"provider = \"claude\"\n", "", "", `provider must be one of copilot, openai, ollama, got "claude"`},
+		{"[ui]\nheight = 4\n", "", "", "unknown setting ui.height"},
+		{"[api]\ntoken_url = \"api.github.com\"\n", "", "", `api.token_url must be an http or https URL, got "api.github.com"`},
+		{"[timeouts]\nrequest = 10\n", "", "", "timeouts.request must be a duration of at least 1s"},
+		{"[ui]\ninput_height = 0\n", "", "", "ui.input_height must be between 1 and 20, got 0"},
+		{"[ui.colors]\nerror = \"red\"\n", "", "", `ui.colors.error must be an ANSI color from 0 to 255 or #rrggbb, got "red"`},
+		{"[headers]\neditor_version = \"\"\n", "", "", "headers.editor_version cannot be empty"},
+		{"[hosts.\"ghes.example.com\"]\nmodels_url = \"models\"\n", "", "", `hosts."ghes.example.com".models_url must be an http or https URL, got "models"`},
+		{"", "GOPILOT_CHAR_LIMIT", "many", `GOPILOT_CHAR_LIMIT must be a number, got "many"`},
+		{"", "GOPILOT_COMPLETION_TIMEOUT", "40", `GOPILOT_COMPLETION_TIMEOUT must be a duration like "40s", got "40"`},
+		{"", "GOPILOT_MODELS_URL", "ftp://models", "api.models_url must be an http or https URL"},
+	}
+
+	for _, tt := range tests {
+		if tt.env != "" {
+			t.Setenv(tt.env, tt.value)
+		}
+
+		_, err := loadConfig(writeTOML(t, tt.content))
+
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v want %s", err, tt.want)
+		}
+
+		if tt.env != "" {
+			os.Unsetenv(tt.env)
+		}
+	}
+}
+
+func TestConfigHeaders(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+
+	path := writeTOML(t, "[headers]\neditor_version = \"Neovim/0.10.0\"\n")
+
+	previous := appConfig
+
+	t.Cleanup(func() { appConfig = previous })
+
+	if err := useConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+
+	if fake.CompletionHeaders[0].Get("editor-version") != "Neovim/0.10.0" {
+		t.Errorf("got %s want %s", fake.CompletionHeaders[0].Get("editor-version"), "Neovim/0.10.0")
+	}
+
+	if fake.CompletionHeaders[0].Get("user-agent") != DefaultConfig.Headers.UserAgent {
+		t.Errorf("got %s want %s", fake.CompletionHeaders[0].Get("user-agent"), DefaultConfig.Headers.UserAgent)
+	}
+}
@@ -3,15 +3,17 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -51,17 +53,24 @@ You can only give one reply for each conversation turn.
 
 const COPILOT_TOKEN_API = "https://api.github.com/copilot_internal/v2/token"
 const COPILOT_COMPLETION_API = "https://api.githubcopilot.com/chat/completions"
-
-type TokenResponse struct {
-	Token string `json:"token"`
+const COPILOT_MODELS_API = "https://api.githubcopilot.com/models"
+
+// CopilotEndpoints are the URLs of the Copilot APIs. They can be pointed to a
+// local server, for instance in tests.
+type CopilotEndpoints struct {
+	TokenURL      string
+	CompletionURL string
+	ModelsURL     string
 }
 
-type GithubCopilotConfigFile struct {
-	GitHubCom struct {
-		User string `json:"user"`
+var DefaultCopilotEndpoints = CopilotEndpoints{
+	TokenURL:      COPILOT_TOKEN_API,
+	CompletionURL: COPILOT_COMPLETION_API,
+	ModelsURL:     COPILOT_MODELS_API,
+}
 
-		OAuthToken string `json:"oauth_token"`
-	} `json:"github.com"`
+type TokenResponse struct {
+	Token string `json:"token"`
 }
 
 type Message struct {
@@ -73,31 +82,27 @@ type Message struct {
 			StartOffset int `json:"start_offset"`
 			EndOffset   int `json:"end_offset"`
 		} `json:"content_filter_offsets"`
-		ContentFilterResults struct {
-			Hate struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"hate"`
-			SelfHarm struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"self_harm"`
-			Sexual struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"sexual"`
-			Violence struct {
-				Filtered bool   `json:"filtered"`
-				Severity string `json:"severity"`
-			} `json:"violence"`
-		} `json:"content_filter_results"`
-		Delta struct {
+		ContentFilterResults *ContentFilterResults `json:"content_filter_results"`
+		Delta                struct {
 			Content interface{} `json:"content"`
 			Role    interface{} `json:"role"`
 		} `json:"delta"`
 	} `json:"choices"`
-	Created int64  `json:"created"`
-	ID      string `json:"id"`
+	Created int64         `json:"created"`
+	ID      string        `json:"id"`
+	Error   *ErrorDetails `json:"error,omitempty"`
+}
+
+type ContentFilterResult struct {
+	Filtered bool   `json:"filtered"`
+	Severity string `json:"severity"`
+}
+
+type ContentFilterResults struct {
+	Hate     ContentFilterResult `json:"hate"`
+	SelfHarm ContentFilterResult `json:"self_harm"`
+	Sexual   ContentFilterResult `json:"sexual"`
+	Violence ContentFilterResult `json:"violence"`
 }
 
 type ErrorResponse struct {
@@ -112,83 +117,121 @@ type ErrorDetails struct {
 }
 
 type CopilotRequest struct {
+	// Account is the -account the GitHub token is read from
+	Account   string
 	Token     string
 	SessionId string
-	UUID      string
 	MachineID string
+	Endpoints CopilotEndpoints
+	Model     ModelInfo
+	Params    GenerationParams
 }
 
 type Request struct {
-	Intent      bool             `json:"intent"`
+	Intent      bool             `json:"intent,omitempty"`
 	Model       string           `json:"model"`
 	N           int              `json:"n"`
 	Stream      bool             `json:"stream"`
 	Temperature float32          `json:"temperature"`
-	TopP        int              `json:"top_p"`
+	TopP        float32          `json:"top_p"`
 	Messages    []HistoryMessage `json:"messages"`
-	History     []HistoryMessage `json:"history"`
-	Maxtokens   int              `json:"max_tokens"`
+	History     []HistoryMessage `json:"history,omitempty"`
+	Maxtokens   int              `json:"max_tokens,omitempty"`
 }
 
-func generateAskRequest(history []HistoryMessage) (Request, error) {
+// generateAskRequest uses the output limit of the model, when it is known,
+// unless the params set a lower one.
+func generateAskRequest(history []HistoryMessage, model ModelInfo, params GenerationParams) (Request, error) {
+	params = params.orDefault()
+
 	req := Request{
 		Intent:      true,
-		Model:       "gpt-4",
-		N:           1,
+		Model:       firstNonEmpty(model.ID, DEFAULT_COPILOT_MODEL),
+		N:           params.N,
 		Stream:      true,
-		Temperature: 0.1,
-		TopP:        1,
+		Temperature: params.Temperature,
+		TopP:        params.TopP,
 		Messages:    history,
-		Maxtokens:   8192,
+		Maxtokens:   DEFAULT_MAX_TOKENS,
+	}
+
+	switch {
+	case params.MaxTokens > 0:
+		req.Maxtokens = params.MaxTokens
+	case model.MaxOutput > 0:
+		req.Maxtokens = model.MaxOutput
 	}
 
 	return req, nil
 }
 
-func readConfig() GithubCopilotConfigFile {
-	filePath := os.Getenv("HOME") + "/.config/github-copilot/hosts.json"
-
-	file, error := os.Open(filePath)
+// getToken exchanges the GitHub token of the account for a Copilot token.
+func getToken(ctx context.Context, name string, tokenURL string) (string, error) {
+	account, err := readAccount(name)
 
-	defer file.Close()
-
-	if error != nil {
-		panic(error)
+	if err != nil {
+		return "", err
 	}
 
-	content, err := io.ReadAll(file)
-
-	var config GithubCopilotConfigFile
+	return requestToken(ctx, account, tokenURL)
+}
 
-	err = json.Unmarshal(content, &config)
+// requestToken stops retrying once ctx is done, only the background refresh
+// is detached from a request.
+func requestToken(ctx context.Context, account GithubAccount, tokenURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL, nil)
 
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
-	return config
-}
+	req.Header.Set("authorization", "token "+account.OAuthToken)
+	req.Header.Set("accept", "application/json")
+	setEditorHeaders(req)
 
-func getToken() string {
-	req, err := http.NewRequest("GET", COPILOT_TOKEN_API, nil)
+	var token string
 
-	if err != nil {
-		panic(err)
-	}
+	err = retry(ctx, func() error {
+		token, err = fetchToken(req)
 
-	config := readConfig()
+		return err
+	})
 
-	req.Header.Set("authorization", "token "+config.GitHubCom.OAuthToken)
-	req.Header.Set("accept", "application/json")
-	req.Header.Set("editor-version", "vscode/1.85.1")
-	req.Header.Set("editor-plugin-version", "copilot-chat/0.12.2023120701")
-	req.Header.Set("user-agent", "GitHubCopilotChat/0.12.2023120701")
+	return token, err
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
+func fetchToken(req *http.Request) (string, error) {
+	client := &http.Client{Timeout: appConfig.Timeouts.Request, Transport: httpTransport}
 	resp, err := client.Do(req)
 
 	if err != nil {
-		panic(err)
+		if ctx := req.Context(); ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+
+		return "", newError(ErrorNetwork, "cannot reach the token API", err)
+	}
+
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		err := newError(ErrorRateLimited, "token API returned "+resp.Status, nil)
+		err.Status = resp.StatusCode
+		err.RetryAfter = parseRetryAfter(resp.Header.Get("retry-after"))
+
+		return "", err
+	case resp.StatusCode >= http.StatusInternalServerError:
+		err := newError(ErrorAPI, "token API returned "+resp.Status, nil)
+		err.Status = resp.StatusCode
+
+		return "", err
+	case resp.StatusCode == http.StatusUnauthorized:
+		return "", newError(ErrorAuthFailed, "the GitHub token was rejected, run gopilot login again", nil)
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusNotFound:
+		return "", newError(ErrorAuthFailed, "this GitHub account has no Copilot seat", nil)
+	case resp.StatusCode != http.StatusOK:
+		return "", newError(ErrorAuthFailed, "token API returned "+resp.Status, nil)
 	}
 
 	var tokenResponse TokenResponse
@@ -196,137 +239,588 @@ func getToken() string {
 	err = json.NewDecoder(resp.Body).Decode(&tokenResponse)
 
 	if err != nil {
-		panic(err)
+		return "", newError(ErrorAuthFailed, "cannot decode the token", err)
 	}
 
-	return tokenResponse.Token
+	if tokenResponse.Token == "" {
+		return "", newError(ErrorAuthFailed, "the token API returned an empty token", nil)
+	}
+
+	return tokenResponse.Token, nil
 }
 
-func generateCopilotRequest() CopilotRequest {
+// generateCopilotRequest creates the session identifiers, the machine ID is
+// the same for every run. The token is fetched lazily by renewToken on the
+// first request.
+func generateCopilotRequest(endpoints CopilotEndpoints) CopilotRequest {
 	return CopilotRequest{
-		Token:     getToken(),
+		Endpoints: endpoints,
 		SessionId: sessionID(),
-		UUID:      uuid(),
 		MachineID: machineID(),
 	}
 }
 
-func getResponse(m *model, callback func(string, bool, bool)) string {
-	request, _ := generateAskRequest(m.history)
+// CopilotProvider is safe for concurrent use, every request works on its own
+// copy of the session. mu only guards the fields and is never held during a
+// request, so the UI can read the model while a token is fetched. tokenMu
+// makes concurrent requests wait for the same new token.
+type CopilotProvider struct {
+	mu      sync.Mutex
+	tokenMu sync.Mutex
+	request CopilotRequest
+
+	// models is the listing of the models endpoint, loaded once
+	models       []ModelInfo
+	modelsLoaded bool
+
+	refreshTimer *time.Timer
+}
+
+func NewCopilotProvider(endpoints CopilotEndpoints) *CopilotProvider {
+	request := generateCopilotRequest(endpoints)
+	request.Model = ModelInfo{ID: DEFAULT_COPILOT_MODEL}
+	request.Params = DefaultGenerationParams
+
+	return &CopilotProvider{request: request}
+}
+
+func (p *CopilotProvider) Send(ctx context.Context, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error) {
+	p.loadModels(ctx)
+
+	c, err := p.session(ctx)
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	completion, err := getResponse(ctx, &c, history, callback)
+
+	// The token can be revoked before it expires, try once more with a new one
+	if hasStatus(err, http.StatusUnauthorized) {
+		log.Println("Token rejected, renewing it")
+
+		c, err = p.refresh(ctx, c.Token)
+
+		if err != nil {
+			return completion, err
+		}
+
+		return getResponse(ctx, &c, history, callback)
+	}
+
+	return completion, err
+}
+
+func (p *CopilotProvider) Reload(ctx context.Context) error {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	p.mu.Lock()
+
+	model := p.request.Model
+	params := p.request.Params
+
+	account := p.request.Account
+
+	p.request = generateCopilotRequest(p.request.Endpoints)
+	p.request.Account = account
+	p.request.Model = model
+	p.request.Params = params
+
+	c := p.request
+
+	p.mu.Unlock()
+
+	forgetToken(c)
+
+	_, err := p.renew(ctx)
+
+	return err
+}
+
+// ResetSession starts a new session, for instance when the chat is cleared.
+func (p *CopilotProvider) ResetSession() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.request.SessionId = sessionID()
+}
+
+func (p *CopilotProvider) SetParams(params GenerationParams) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.request.Params = params
+}
+
+// refresh fetches a new token unless another request already replaced the
+// rejected one.
+func (p *CopilotProvider) refresh(ctx context.Context, rejected string) (CopilotRequest, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	p.mu.Lock()
+
+	forget := p.request.Token == rejected
+
+	if forget {
+		p.request.Token = ""
+	}
+
+	c := p.request
+
+	p.mu.Unlock()
+
+	if forget {
+		forgetToken(c)
+	}
+
+	return p.renew(ctx)
+}
+
+// session returns a copy of the session with a valid token.
+func (p *CopilotProvider) session(ctx context.Context) (CopilotRequest, error) {
+	p.tokenMu.Lock()
+	defer p.tokenMu.Unlock()
+
+	return p.renew(ctx)
+}
+
+// getResponse expects c to hold a valid token, see CopilotProvider.session.
+func getResponse(ctx context.Context, c *CopilotRequest, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error) {
+	request, _ := generateAskRequest(history, c.Model, c.Params)
 	body, err := json.Marshal(request)
 
-	log.Println("History:", m.history[1:])
+	log.Println("History:", history[1:])
 
 	if err != nil {
-		panic(err)
+		return Completion{}, err
 	}
 
-	renewToken(m)
+	req, err := newCompletionRequest(ctx, c, body)
 
-	bodyBuffer := bytes.NewBuffer(body)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	return streamResponse(req, callback)
+}
 
-	req, err := http.NewRequest("POST", COPILOT_COMPLETION_API, bodyBuffer)
+// newCompletionRequest builds the chat completion request with the headers
+// the VSCode extension sends.
+func newCompletionRequest(ctx context.Context, c *CopilotRequest, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.Endpoints.CompletionURL, bytes.NewBuffer(body))
 
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	req.Header.Set("authorization", "Bearer "+m.copilotRequest.Token)
-	req.Header.Set("vscode-sessionid", m.copilotRequest.SessionId)
-	req.Header.Set("x-request-id", m.copilotRequest.UUID)
-	req.Header.Set("vscode-machineid", m.copilotRequest.MachineID)
+	setCopilotHeaders(req, c)
 
 	req.Header.Set("content-type", "application/json")
 	req.Header.Set("openai-intent", "conversation-panel")
+
+	req.Header.Set("accept", "*/*")
+	req.Header.Set("accept-encoding", "gzip,deflate,br")
+
+	return req, nil
+}
+
+// setCopilotHeaders sets the session and editor headers every Copilot API
+// expects.
+func setCopilotHeaders(req *http.Request, c *CopilotRequest) {
+	req.Header.Set("authorization", "Bearer "+c.Token)
+	req.Header.Set("vscode-sessionid", c.SessionId)
+	req.Header.Set("x-request-id", uuid())
+	req.Header.Set("vscode-machineid", c.MachineID)
+
 	req.Header.Set("openai-organization", "github-copilot")
-	req.Header.Set("user-agent", "GitHubCopilotChat/0.14.2024032901")
-	req.Header.Set("editor-version", "vscode/1.88.0")
-	req.Header.Set("editor-plugin-version", "copilot-chat/0.14.2024032901")
+	setEditorHeaders(req)
 	req.Header.Set("x-github-api-version", "2023-07-07")
 	req.Header.Set("copilot-integration-id", "vscode-chat")
+}
 
-	req.Header.Set("accept", "*/*")
-	req.Header.Set("accept-encoding", "gzip,deflate,br")
+// setEditorHeaders introduces gopilot as the editor of the config file.
+func setEditorHeaders(req *http.Request) {
+	req.Header.Set("editor-version", appConfig.Headers.EditorVersion)
+	req.Header.Set("editor-plugin-version", appConfig.Headers.EditorPluginVersion)
+	req.Header.Set("user-agent", appConfig.Headers.UserAgent)
+}
 
-	client := &http.Client{Timeout: 40 * time.Second}
-	resp, err := client.Do(req)
+// errIdleTimeout is returned when the completion API sends nothing for longer
+// than the completion timeout.
+var errIdleTimeout = errors.New("no data received within the completion timeout")
+
+// doCompletionRequest sends a chat completion request. A cancelled context is
+// returned as is so the caller can tell it apart from a network error. The
+// completion timeout applies to the wait for the response and then between
+// the reads of its body, so a long answer is not cut while it streams.
+func doCompletionRequest(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	body := &idleBody{timeout: appConfig.Timeouts.Completion, cancel: cancel}
+	body.timer = time.AfterFunc(body.timeout, body.expire)
+
+	client := &http.Client{Transport: httpTransport}
+	resp, err := client.Do(req.WithContext(ctx))
 
 	if err != nil {
-		panic(err)
+		body.Close()
+
+		if ctx := req.Context(); ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if body.expired.Load() {
+			err = errIdleTimeout
+		}
+
+		return nil, newError(ErrorNetwork, "cannot reach "+req.URL.Host, err)
 	}
 
-	return parseResponse(resp.Body, callback)
+	body.ReadCloser = resp.Body
+	resp.Body = body
+
+	return resp, nil
+}
+
+// idleBody cancels the request when no data is read for the timeout.
+type idleBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	cancel  context.CancelFunc
+	expired atomic.Bool
 }
 
-func parseResponse(s io.ReadCloser, callback func(string, bool, bool)) string {
-	dec := bufio.NewReader(s)
+func (b *idleBody) expire() {
+	b.expired.Store(true)
+	b.cancel()
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if err != nil && err != io.EOF && b.expired.Load() {
+		return n, errIdleTimeout
+	}
+
+	b.timer.Reset(b.timeout)
+
+	return n, err
+}
+
+func (b *idleBody) Close() error {
+	b.timer.Stop()
+	b.cancel()
+
+	if b.ReadCloser == nil {
+		return nil
+	}
+
+	return b.ReadCloser.Close()
+}
+
+// streamResponse sends a chat completion request and parses its SSE stream.
+// Transient failures are retried as long as nothing has been streamed yet,
+// the final callback of a failed attempt is only forwarded if it is the last.
+func streamResponse(req *http.Request, callback func(string, bool, bool)) (Completion, error) {
+	var completion Completion
+	var done func()
+
+	err := retry(req.Context(), func() error {
+		var err error
+
+		streamed := false
+		done = nil
+
+		completion, err = sendCompletionRequest(req, func(reply string, last bool, isError bool) {
+			if last {
+				done = func() { callback(reply, true, isError) }
+
+				return
+			}
+
+			streamed = true
+
+			callback(reply, false, isError)
+		})
+
+		if err != nil && streamed {
+			return permanentError{err}
+		}
+
+		return err
+	})
+
+	if done != nil {
+		done()
+	}
+
+	return completion, err
+}
+
+// sendCompletionRequest makes a single attempt, the request is cloned so its
+// body can be sent again.
+func sendCompletionRequest(req *http.Request, callback func(string, bool, bool)) (Completion, error) {
+	attempt := req.Clone(req.Context())
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+
+		if err != nil {
+			return Completion{}, err
+		}
+
+		attempt.Body = body
+	}
+
+	resp, err := doCompletionRequest(attempt)
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := statusError(resp, requestModel(req))
+
+		callback(err.Message, true, true)
+
+		return Completion{Content: err.Message}, err
+	}
+
+	return parseResponse(req.Context(), resp.Body, callback)
+}
+
+// requestModel reads the model back from the request body.
+func requestModel(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+
+	body, err := req.GetBody()
+
+	if err != nil {
+		return ""
+	}
+
+	defer body.Close()
+
+	var request struct {
+		Model string `json:"model"`
+	}
+
+	json.NewDecoder(body).Decode(&request)
+
+	return request.Model
+}
+
+// statusError builds the error of a failed response from its status, its
+// headers and the error body, if any. The statuses with a known meaning get a
+// message telling the user what to do, with the API message as the cause.
+func statusError(resp *http.Response, model string) *ProviderError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var response ErrorResponse
+	var cause error
+
+	decoded := json.Unmarshal(body, &response) == nil && response.Error.Message != ""
+
+	if decoded {
+		cause = errors.New(response.Error.Message)
+	}
+
+	var err *ProviderError
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		err = newError(ErrorAuthFailed, "the Copilot token was rejected", cause)
+	case http.StatusForbidden:
+		err = newError(ErrorAuthFailed, "this GitHub account has no Copilot seat", cause)
+	case http.StatusNotFound:
+		err = newError(ErrorAPI, fmt.Sprintf("the model %q is not available", model), cause)
+	case http.StatusRequestEntityTooLarge:
+		err = newError(ErrorAPI, "the conversation is too large for the model, clear it or send less context", cause)
+	default:
+		if decoded {
+			err = errorFromResponse(response)
+		} else {
+			err = newError(ErrorAPI, "the API returned "+resp.Status, nil)
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err.Kind = ErrorRateLimited
+	}
+
+	err.Code = response.Error.Code
+	err.Status = resp.StatusCode
+	err.RetryAfter = parseRetryAfter(resp.Header.Get("retry-after"))
+
+	return err
+}
+
+func parseResponse(ctx context.Context, s io.ReadCloser, callback func(string, bool, bool)) (Completion, error) {
+	reader := bufio.NewReader(s)
+
+	// Errors can come as a plain JSON body instead of an event stream
+	if isJSONBody(reader) {
+		return parseErrorBody(reader, callback)
+	}
+
+	decoder := NewEventDecoder(reader)
 	isError := false
+	var responseError error
+	var completion Completion
 
-	reply := make([]byte, 0)
+	reply := ""
+	events := 0
 
 	for {
-		content, err := dec.ReadBytes('\n')
+		event, err := decoder.Next()
+
+		// A body that is neither JSON nor an event stream, e.g. a proxy error page
+		if err == io.EOF && events == 0 {
+			isError = true
+			responseError = newError(ErrorAPI, "the response contained no events", nil)
+
+			break
+		}
+
+		if err == io.EOF {
+			break
+		}
 
 		if err != nil {
-			log.Println("Response was not nil:", err)
+			log.Println("Cannot read the response:", err)
+
+			responseError = newError(ErrorNetwork, "the response was interrupted", err)
 
 			break
 		}
 
-		s := strings.Trim(string(content), " \n\t")
+		events++
+
+		log.Println("Content:", event.Data)
 
-		log.Println("Content:", s)
+		if event.Data == SSE_DONE {
+			break
+		}
 
-		if strings.HasPrefix(s, `{"error":`) {
-			var error ErrorResponse
+		var message Message
 
-			json.Unmarshal([]byte(s), &error)
+		err = json.Unmarshal([]byte(event.Data), &message)
 
-			reply = []byte(error.Error.Message)
+		if err != nil {
 			isError = true
+			responseError = newError(ErrorAPI, fmt.Sprintf("malformed chunk %q", event.Data), err)
 
 			break
 		}
 
-		if strings.HasPrefix(s, "[DONE]") {
+		if message.Error != nil {
+			reply = message.Error.Message
+			isError = true
+			responseError = errorFromResponse(ErrorResponse{Error: *message.Error})
+
 			break
 		}
 
-		if !strings.HasPrefix(s, "data:") {
+		// Only the first choice is shown when more than one is requested
+		index := -1
+
+		for i := range message.Choices {
+			if message.Choices[i].Index == 0 {
+				index = i
+
+				break
+			}
+		}
+
+		if index == -1 {
 			continue
 		}
 
-		jsonExtract := removeUntilData(string(s))
+		choice := message.Choices[index]
 
-		var message Message
+		if choice.FinishReason != "" {
+			completion.FinishReason = choice.FinishReason
+		}
 
-		json.Unmarshal([]byte(jsonExtract), &message)
+		if choice.ContentFilterResults != nil {
+			completion.ContentFilterResults = choice.ContentFilterResults
+		}
 
-		if len(message.Choices) > 0 {
-			if message.Choices[0].Delta.Content != nil {
-				txt := message.Choices[0].Delta.Content.(string)
-				reply = append(reply, []byte(txt)...)
+		if choice.Delta.Content == nil {
+			continue
+		}
 
-				callback(string(reply), false, isError)
-			}
+		txt, ok := choice.Delta.Content.(string)
+
+		if !ok {
+			isError = true
+			responseError = newError(ErrorAPI, fmt.Sprintf("malformed chunk %q", event.Data), nil)
+
+			break
 		}
+
+		reply += txt
+
+		callback(reply, false, isError)
 	}
 
-	callback(string(reply), true, isError)
+	callback(reply, true, isError)
 
-	log.Println("Reply:", string(reply))
+	log.Println("Reply:", reply)
 
-	return string(reply)
+	completion.Content = reply
+
+	if ctx.Err() != nil {
+		return completion, ctx.Err()
+	}
+
+	return completion, responseError
 }
 
-func removeUntilData(s string) string {
-	index := strings.Index(s, "data:")
+// isJSONBody skips the leading blanks and tells whether the body is a JSON
+// object rather than an event stream.
+func isJSONBody(reader *bufio.Reader) bool {
+	for {
+		c, err := reader.ReadByte()
+
+		if err != nil {
+			return false
+		}
+
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			reader.UnreadByte()
 
-	if index == -1 {
-		return s
+			return c == '{'
+		}
 	}
+}
+
+func parseErrorBody(reader io.Reader, callback func(string, bool, bool)) (Completion, error) {
+	body, _ := io.ReadAll(reader)
+
+	log.Println("Content:", string(body))
+
+	var response ErrorResponse
+
+	err := json.Unmarshal(body, &response)
+
+	if err != nil || response.Error.Message == "" {
+		err = newError(ErrorAPI, fmt.Sprintf("malformed response %q", strings.TrimSpace(string(body))), err)
+
+		callback(err.Error(), true, true)
 
-	return s[index+len("data: "):]
+		return Completion{Content: err.Error()}, err
+	}
+
+	callback(response.Error.Message, true, true)
+
+	return Completion{Content: response.Error.Message}, errorFromResponse(response)
 }
 
 func extractExpiration(s string) int64 {
@@ -353,54 +847,23 @@ func extractExpiration(s string) int64 {
 	return timestamp
 }
 
+// isExpired tells whether a token expires within TOKEN_EXPIRY_MARGIN.
 func isExpired(t int64) bool {
-	return t+60 < time.Now().Unix()
+	return time.Now().Add(TOKEN_EXPIRY_MARGIN).Unix() >= t
 }
 
-func renewToken(m *model) {
-	if isExpired(extractExpiration(m.copilotRequest.Token)) {
+func renewToken(ctx context.Context, c *CopilotRequest) error {
+	if isExpired(extractExpiration(c.Token)) {
 		log.Println("Renewing expired token")
 
-		m.copilotRequest.Token = getToken()
-	}
-}
-
-/* NOTE: the following functions have been ported from Lua using Copilot.
- *       original source:
- *       https://github.com/CopilotC-Nvim/CopilotChat.nvim/blob/9898b4cd1b19c6ca639b77b34bb599a119356c1f/lua/CopilotChat/copilot.lua
- */
+		token, err := cachedToken(ctx, c.Account, c.Endpoints.TokenURL)
 
-func uuid() string {
-	rand.NewSource(time.Now().UnixNano())
-	template := "xxxxxxxx-xxxx-4xxx-yxxx-xxxxxxxxxxxx"
-	uuid := ""
-
-	for _, c := range template {
-		if c == 'x' {
-			uuid += fmt.Sprintf("%x", rand.Intn(16))
-		} else if c == 'y' {
-			uuid += fmt.Sprintf("%x", rand.Intn(4)+8)
-		} else {
-			uuid += string(c)
+		if err != nil {
+			return err
 		}
-	}
-
-	return uuid
-}
 
-func machineID() string {
-	length := 65
-	hexChars := "0123456789abcdef"
-	hex := ""
-	rand.NewSource(time.Now().UnixNano())
-
-	for i := 0; i < length; i++ {
-		hex += string(hexChars[rand.Intn(len(hexChars))])
+		c.Token = token
 	}
 
-	return hex
-}
-
-func sessionID() string {
-	return uuid() + fmt.Sprint(time.Now().UnixNano()/int64(time.Millisecond))
+	return nil
 }
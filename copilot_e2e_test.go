@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopilotProviderSend(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.Chunks = []string{"hello", " from", " fake"}
+
+	provider := NewCopilotProvider(fake.Endpoints())
+	history := []HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("hi")}
+	deltas := 0
+
+	got, err := provider.Send(context.Background(), history, func(reply string, done bool, isError bool) {
+		if !done {
+			deltas++
+		}
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Content != "hello from fake" || got.FinishReason != "stop" {
+		t.Errorf("got %+v want %s", got, "hello from fake")
+	}
+
+	if deltas != 3 {
+		t.Errorf("got %d want %d", deltas, 3)
+	}
+
+	headers := fake.CompletionHeaders[0]
+
+	for _, header := range []string{"vscode-sessionid", "x-request-id", "vscode-machineid", "editor-version", "editor-plugin-version", "copilot-integration-id", "openai-intent"} {
+		if headers.Get(header) == "" {
+			t.Errorf("Missing header %s", header)
+		}
+	}
+
+	body := fake.CompletionBodies[0]
+
+	if body.Model != "gpt-4" || len(body.Messages) != 2 || !body.Stream {
+		t.Errorf("got %+v want the chat request", body)
+	}
+}
+
+func TestCopilotProviderTokenRenewal(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want int
+	}{
+		{time.Hour, 1},
+		// Every request is rejected, renewing the token and retrying once. The
+		// first token is also used to list the models.
+		{-30 * time.Second, 5},
+	}
+
+	for _, tt := range tests {
+		writeHostsFile(t)
+
+		fake := NewFakeCopilot(t)
+		fake.TokenTTL = tt.ttl
+
+		provider := NewCopilotProvider(fake.Endpoints())
+
+		for i := 0; i < 2; i++ {
+			_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+			// An expired token is rejected by the completion API
+			if tt.ttl < 0 && !errors.Is(err, &ProviderError{Kind: ErrorAuthFailed}) {
+				t.Errorf("got %v want %s", err, ErrorAuthFailed)
+			}
+
+			if tt.ttl > 0 && err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if fake.TokenRequests != tt.want {
+			t.Errorf("got %d want %d token requests", fake.TokenRequests, tt.want)
+		}
+	}
+}
+
+func TestCopilotProviderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(f *FakeCopilot)
+		want  ErrorKind
+	}{
+		{"token rejected", func(f *FakeCopilot) { f.TokenStatus = http.StatusForbidden }, ErrorAuthFailed},
+		{"token rate limited", func(f *FakeCopilot) { f.TokenStatus = http.StatusTooManyRequests }, ErrorRateLimited},
+		{"filtered", func(f *FakeCopilot) {
+			f.CompletionStatus = http.StatusBadRequest
+			f.CompletionBody = `{"error":{"code":"off_topic","message":"filtered"}}`
+		}, ErrorFiltered},
+		{"offline", func(f *FakeCopilot) { f.Close() }, ErrorNetwork},
+	}
+
+	for _, tt := range tests {
+		writeHostsFile(t)
+
+		fake := NewFakeCopilot(t)
+		tt.setup(fake)
+
+		provider := NewCopilotProvider(fake.Endpoints())
+
+		_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+		if !errors.Is(err, &ProviderError{Kind: tt.want}) {
+			t.Errorf("%s: got %v want %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCopilotProviderTokenRevoked(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.Failures = []int{http.StatusUnauthorized}
+
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	got, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if err != nil || got.Content != "hello" {
+		t.Fatalf("got %s %v want %s", got.Content, err, "hello")
+	}
+
+	if fake.TokenRequests != 2 || len(fake.CompletionBodies) != 2 {
+		t.Errorf("got %d token and %d completion requests want 2 of each", fake.TokenRequests, len(fake.CompletionBodies))
+	}
+
+	if fake.CompletionHeaders[0].Get("authorization") == fake.CompletionHeaders[1].Get("authorization") {
+		t.Errorf("The retry did not use a new token")
+	}
+}
+
+func TestCopilotProviderStatusErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		kind   ErrorKind
+		want   string
+	}{
+		{http.StatusForbidden, ErrorAuthFailed, "no Copilot seat"},
+		{http.StatusNotFound, ErrorAPI, `model "gpt-4" is not available`},
+		{http.StatusRequestEntityTooLarge, ErrorAPI, "too large"},
+	}
+
+	for _, tt := range tests {
+		writeHostsFile(t)
+
+		fake := NewFakeCopilot(t)
+		fake.CompletionStatus = tt.status
+		fake.CompletionBody = "not json"
+
+		provider := NewCopilotProvider(fake.Endpoints())
+
+		_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+		if !errors.Is(err, &ProviderError{Kind: tt.kind}) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v want %s: %s", err, tt.kind, tt.want)
+		}
+
+		if len(fake.CompletionBodies) != 1 {
+			t.Errorf("got %d requests want %d", len(fake.CompletionBodies), 1)
+		}
+	}
+}
+
+func TestCopilotProviderSlowResponseCancel(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.Chunks = []string{"hello", " never", " sent"}
+	fake.Delay = 100 * time.Millisecond
+
+	provider := NewCopilotProvider(fake.Endpoints())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	got, err := provider.Send(ctx, []HistoryMessage{createHistoryEntry("hi")}, func(reply string, done bool, isError bool) {
+		if !done {
+			cancel()
+		}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v want %v", err, context.Canceled)
+	}
+
+	if got.Content != "hello" {
+		t.Errorf("got %s want %s", got.Content, "hello")
+	}
+}
+
+func TestServeProxy(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.Chunks = []string{"proxied"}
+
+	server := httptest.NewServer((&Server{provider: NewCopilotProvider(fake.Endpoints())}).Handler())
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json", strings.NewReader(`{"messages":[{"role":"user","content":"hi"}],"stream":true}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("content-type") != "text/event-stream" {
+		t.Errorf("got %s %s want a SSE stream", resp.Status, resp.Header.Get("content-type"))
+	}
+
+	if !strings.Contains(string(body), `"content":"proxied"`) || !strings.HasSuffix(string(body), "data: [DONE]\n\n") {
+		t.Errorf("got %s want the relayed stream", body)
+	}
+
+	if fake.CompletionHeaders[0].Get("copilot-integration-id") != "vscode-chat" {
+		t.Errorf("Missing Copilot headers")
+	}
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 )
 
 type MockReadCloser struct {
@@ -20,55 +26,52 @@ func (m *MockReadCloser) Close() error {
 	return nil
 }
 
-func TestRemoveDataUntil(t *testing.T) {
-	tests := []struct {
-		input string
-		want  string
-	}{
-		{`data: {"choices":[{"delta":{"content":"hello"}}]}`, `{"choices":[{"delta":{"content":"hello"}}]}`},
-		{`{"choices":[{"delta":{"content":"hello"}}]}`, `{"choices":[{"delta":{"content":"hello"}}]}`},
-		{"foo", "foo"},
-		{"", ""},
-	}
-
-	for _, tt := range tests {
-		got := removeUntilData(tt.input)
-
-		if got != tt.want {
-			t.Errorf("got %s want %s", got, tt.want)
-		}
-	}
-}
-
 func TestParseResponse(t *testing.T) {
 	tests := []struct {
 		input               string
 		want                string
 		callbackCalledTimes int
+		wantErr             bool
 	}{
 		{`
 		data: {"choices":[{"delta":{"content":"hello"}}]}
+
 		data: {"choices":[{"delta":{"content":" "}}]}
+
 		data: {"choices":[{"delta":{"content":"from"}}]}
 		\n
+
 		data: {"choices":[{"delta":{"content":" "}}]}
+
 		data: {"choices":[{"delta":{"content":"here."}}]}
+
 		data: {"choices":[{"delta":{"content":"\n"}}]}
+
 		data: {"choices":[{"delta":{"content":"Bye!"}}]}
 
-		[DONE]
+		data: [DONE]
 		`, "hello from here.\nBye!",
-			8},
+			8, false},
 		{`
 		data: {"choices":[{"delta":{"content":"hello"}}]}
-		[DONE]
+
+		data: [DONE]
+
 		data: {"choices":[{"delta":{"content":" "}}]}
+
 		data: {"choices":[{"delta":{"content":"from"}}]}
 		`, "hello",
-			2},
-		{"", "", 1},
+			2, false},
+		{": keep-alive\r\nevent: message\r\nid: 1\r\ndata: {\"choices\":[{\"delta\":{\"content\":\"crlf\"}}]}\r\n\r\ndata: [DONE]\r\n\r\n", "crlf", 2, false},
+		{"data: {\"choices\":\r\ndata: [{\"delta\":{\"content\":\"split\"}}]}\r\n\r\n", "split", 2, false},
+		{"data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\ndata: {\"choices\":[{\"delta\n\n", "hello", 2, true},
+		{"data: {\"choices\":[{\"delta\":{\"content\":42}}]}\n\n", "", 1, true},
+		{"data: {\"error\":{\"code\":\"rate_limited\",\"message\":\"slow down\"}}\n\n", "slow down", 1, true},
+		{"<html>Bad gateway</html>", "", 1, true},
+		{"", "", 1, true},
+		{`data: {"choices":[{"delta":{"content":"no newline"}}]}`, "no newline", 2, false},
 		{`{"error":{"code":"off_topic","message":"The response was filtered due to the prompt not being programming related. Please modify your prompt and retry.","param":"prompt","type":"invalid_request_error"}}
-		`, "The response was filtered due to the prompt not being programming related. Please modify your prompt and retry.", 1},
+		`, "The response was filtered due to the prompt not being programming related. Please modify your prompt and retry.", 1, true},
 	}
 
 	for _, tt := range tests {
@@ -76,12 +79,16 @@ func TestParseResponse(t *testing.T) {
 		totalCalls := 0
 		finished := false
 
-		got := parseResponse(mockReader, func(s string, b bool, e bool) {
+		got, err := parseResponse(context.Background(), mockReader, func(s string, b bool, e bool) {
 			totalCalls++
 
 			finished = b
 		})
 
+		if (err != nil) != tt.wantErr {
+			t.Errorf("got %v want error %t", err, tt.wantErr)
+		}
+
 		if totalCalls != tt.callbackCalledTimes {
 			t.Errorf("got %d want %d", totalCalls, tt.callbackCalledTimes)
 		}
@@ -90,12 +97,80 @@ func TestParseResponse(t *testing.T) {
 			t.Errorf("Not finished")
 		}
 
-		if got != tt.want {
-			t.Errorf("got %s want %s", got, tt.want)
+		if got.Content != tt.want {
+			t.Errorf("got %s want %s", got.Content, tt.want)
+		}
+	}
+}
+
+func TestParseResponseChoices(t *testing.T) {
+	input := `data: {"choices":[{"index":0,"delta":{"content":"first"}},{"index":1,"delta":{"content":"second"}}]}
+
+data: {"choices":[{"index":1,"delta":{"content":" answer"}}]}
+
+data: {"choices":[{"index":0,"delta":{"content":" answer"}}]}
+
+data: [DONE]
+
+`
+
+	got, err := parseResponse(context.Background(), &MockReadCloser{data: input}, func(string, bool, bool) {})
+
+	if err != nil || got.Content != "first answer" {
+		t.Errorf("got %s %v want %s", got.Content, err, "first answer")
+	}
+}
+
+func TestGenerateAskRequest(t *testing.T) {
+	tests := []struct {
+		model     ModelInfo
+		params    GenerationParams
+		want      string
+		maxTokens int
+	}{
+		{ModelInfo{}, GenerationParams{}, DEFAULT_COPILOT_MODEL, DEFAULT_MAX_TOKENS},
+		{ModelInfo{ID: "gpt-4o", MaxOutput: 16384}, DefaultGenerationParams, "gpt-4o", 16384},
+		{ModelInfo{ID: "gpt-4o", MaxOutput: 16384}, GenerationParams{Temperature: 1, TopP: 0.5, MaxTokens: 100, N: 2}, "gpt-4o", 100},
+	}
+
+	for _, tt := range tests {
+		got, _ := generateAskRequest([]HistoryMessage{createHistoryEntry("hi")}, tt.model, tt.params)
+		params := tt.params.orDefault()
+
+		if got.Model != tt.want || got.Maxtokens != tt.maxTokens {
+			t.Errorf("got %s with %d max tokens want %s with %d", got.Model, got.Maxtokens, tt.want, tt.maxTokens)
+		}
+
+		if got.Temperature != params.Temperature || got.TopP != params.TopP || got.N != params.N {
+			t.Errorf("got %+v want %+v", got, params)
 		}
 	}
 }
 
+func TestParseResponseMetadata(t *testing.T) {
+	input := `data: {"choices":[{"index":0,"content_filter_results":{"hate":{"filtered":false,"severity":"safe"},"self_harm":{"filtered":false,"severity":"safe"},"sexual":{"filtered":false,"severity":"safe"},"violence":{"filtered":true,"severity":"medium"}},"delta":{"content":"hello"}}]}
+
+data: {"choices":[{"index":0,"finish_reason":"content_filter","delta":{"content":null}}]}
+
+data: [DONE]
+
+`
+
+	got, err := parseResponse(context.Background(), &MockReadCloser{data: input}, func(string, bool, bool) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.FinishReason != "content_filter" {
+		t.Errorf("got %s want %s", got.FinishReason, "content_filter")
+	}
+
+	if got.ContentFilterResults == nil || !got.ContentFilterResults.Violence.Filtered {
+		t.Errorf("got %v want violence filtered", got.ContentFilterResults)
+	}
+}
+
 func TestExtractExpiration(t *testing.T) {
 	tests := []struct {
 		input string
@@ -133,3 +208,52 @@ func TestIsExpired(t *testing.T) {
 		}
 	}
 }
+
+func TestCompletionIdleTimeout(t *testing.T) {
+	previous := appConfig
+
+	t.Cleanup(func() { appConfig = previous })
+
+	appConfig.Timeouts.Completion = 200 * time.Millisecond
+
+	tests := []struct {
+		pause   time.Duration
+		wantErr bool
+	}{
+		// Streaming for longer than the timeout is fine while chunks arrive
+		{50 * time.Millisecond, false},
+		{time.Second, true},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 6; i++ {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"w%d \"}}]}\n\n", i)
+
+				w.(http.Flusher).Flush()
+
+				select {
+				case <-time.After(tt.pause):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		}))
+
+		provider := &OpenAIProvider{BaseURL: server.URL, Model: "llama3"}
+
+		_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("got %v want error %t", err, tt.wantErr)
+		}
+
+		if tt.wantErr && !errors.Is(err, errIdleTimeout) {
+			t.Errorf("got %v want %v", err, errIdleTimeout)
+		}
+
+		server.Close()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ErrorKind int
+
+const (
+	ErrorAPI ErrorKind = iota
+	ErrorConfigMissing
+	ErrorAuthFailed
+	ErrorNetwork
+	ErrorRateLimited
+	ErrorFiltered
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorConfigMissing:
+		return "config missing"
+	case ErrorAuthFailed:
+		return "authentication failed"
+	case ErrorNetwork:
+		return "network error"
+	case ErrorRateLimited:
+		return "rate limited"
+	case ErrorFiltered:
+		return "response filtered"
+	}
+
+	return "API error"
+}
+
+// ProviderError is returned by the providers and the token flow so the UI can
+// tell the user what went wrong instead of crashing.
+type ProviderError struct {
+	Kind ErrorKind
+	// Code is the error code returned by the API, if any
+	Code    string
+	Message string
+	Err     error
+	// Status is the HTTP status of the failed response, if any
+	Status int
+	// RetryAfter is how long the API asked to wait before retrying
+	RetryAfter time.Duration
+}
+
+func (e *ProviderError) Error() string {
+	if e.Message == "" && e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Kind, e.Message, e.Err)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// Is allows errors.Is(err, &ProviderError{Kind: ErrorRateLimited}) to match
+// any error of the same kind.
+func (e *ProviderError) Is(target error) bool {
+	t, ok := target.(*ProviderError)
+
+	return ok && t.Kind == e.Kind
+}
+
+func newError(kind ErrorKind, message string, err error) *ProviderError {
+	return &ProviderError{Kind: kind, Message: message, Err: err}
+}
+
+// hasStatus tells whether err was caused by a response with the given status.
+func hasStatus(err error, status int) bool {
+	var providerError *ProviderError
+
+	return errors.As(err, &providerError) && providerError.Status == status
+}
+
+// errorFromResponse maps an API error body to a typed error.
+func errorFromResponse(response ErrorResponse) *ProviderError {
+	kind := ErrorAPI
+
+	switch response.Error.Code {
+	case "off_topic", "content_filter":
+		kind = ErrorFiltered
+	case "rate_limited", "rate_limit_exceeded":
+		kind = ErrorRateLimited
+	case "unauthorized", "invalid_token", "token_expired":
+		kind = ErrorAuthFailed
+	}
+
+	err := newError(kind, response.Error.Message, nil)
+	err.Code = response.Error.Code
+
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorFromResponse(t *testing.T) {
+	tests := []struct {
+		code string
+		want ErrorKind
+	}{
+		{"off_topic", ErrorFiltered},
+		{"content_filter", ErrorFiltered},
+		{"rate_limited", ErrorRateLimited},
+		{"unauthorized", ErrorAuthFailed},
+		{"something_else", ErrorAPI},
+	}
+
+	for _, tt := range tests {
+		got := errorFromResponse(ErrorResponse{Error: ErrorDetails{Code: tt.code, Message: "message"}})
+
+		if got.Kind != tt.want {
+			t.Errorf("got %s want %s", got.Kind, tt.want)
+		}
+
+		if !errors.Is(got, &ProviderError{Kind: tt.want}) {
+			t.Errorf("errors.Is did not match %s", tt.want)
+		}
+	}
+}
+
+func TestReadConfigMissing(t *testing.T) {
+	setConfigHome(t)
+
+	_, err := readAccount("")
+
+	if !errors.Is(err, &ProviderError{Kind: ErrorConfigMissing}) {
+		t.Errorf("got %v want %s", err, ErrorConfigMissing)
+	}
+
+	_, err = getToken(context.Background(), "", COPILOT_TOKEN_API)
+
+	if !errors.Is(err, &ProviderError{Kind: ErrorConfigMissing}) {
+		t.Errorf("got %v want %s", err, ErrorConfigMissing)
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		kind   ErrorKind
+		code   string
+		want   string
+	}{
+		{http.StatusUnauthorized, `{"error":{"code":"unauthorized","message":"token expired"}}`, ErrorAuthFailed, "unauthorized", "authentication failed: the Copilot token was rejected: token expired"},
+		{http.StatusForbidden, "", ErrorAuthFailed, "", "authentication failed: this GitHub account has no Copilot seat"},
+		{http.StatusNotFound, `{"error":{"code":"model_not_found","message":"unknown model"}}`, ErrorAPI, "model_not_found", `API error: the model "gpt-4o" is not available: unknown model`},
+		{http.StatusRequestEntityTooLarge, "<html>Too large</html>", ErrorAPI, "", "API error: the conversation is too large for the model, clear it or send less context"},
+		{http.StatusBadRequest, `{"error":{"code":"off_topic","message":"filtered"}}`, ErrorFiltered, "off_topic", "response filtered: filtered"},
+		{http.StatusTooManyRequests, "", ErrorRateLimited, "", "rate limited: the API returned 429 Too Many Requests"},
+		{http.StatusBadGateway, "<html>Bad gateway</html>", ErrorAPI, "", "API error: the API returned 502 Bad Gateway"},
+	}
+
+	for _, tt := range tests {
+		resp := &http.Response{
+			StatusCode: tt.status,
+			Status:     fmt.Sprintf("%d %s", tt.status, http.StatusText(tt.status)),
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader(tt.body)),
+		}
+
+		got := statusError(resp, "gpt-4o")
+
+		if got.Kind != tt.kind || got.Code != tt.code || got.Status != tt.status || got.Error() != tt.want {
+			t.Errorf("got %s (%s, %d) want %s (%s)", got, got.Code, got.Status, tt.want, tt.code)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeCopilot is a local stand-in for both the token and the completion APIs.
+// The zero values of the script fields give a working server that answers
+// "hello" with tokens valid for an hour.
+type FakeCopilot struct {
+	*httptest.Server
+
+	mu sync.Mutex
+
+	// Chunks are streamed as SSE deltas, waiting Delay before each one
+	Chunks []string
+	Delay  time.Duration
+
+	// CompletionStatus and CompletionBody replace the stream when set
+	CompletionStatus int
+	CompletionBody   string
+
+	// Failures are answered, one per request, before streaming the chunks
+	Failures   []int
+	RetryAfter string
+
+	// TokenTTL is how long the issued tokens are valid for, it can be negative
+	TokenTTL    time.Duration
+	TokenStatus int
+	// TokenDelay is waited before answering a token request
+	TokenDelay time.Duration
+
+	// Models is the listing of the models endpoint, ModelsStatus replaces it
+	Models       []CopilotModel
+	ModelsStatus int
+
+	TokenRequests     int
+	CompletionHeaders []http.Header
+	CompletionBodies  []Request
+
+	tokens int
+	token  string
+}
+
+func NewFakeCopilot(t *testing.T) *FakeCopilot {
+	f := &FakeCopilot{
+		Chunks:   []string{"hello"},
+		TokenTTL: time.Hour,
+		Models: []CopilotModel{
+			fakeModel("gpt-4", "chat", 32768, 4096),
+			fakeModel("gpt-4o", "chat", 128000, 16384),
+			fakeModel("text-embedding-3-small", "embeddings", 8191, 0),
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/copilot_internal/v2/token", f.handleToken)
+	mux.HandleFunc("/chat/completions", f.handleCompletion)
+	mux.HandleFunc("/models", f.handleModels)
+
+	f.Server = httptest.NewServer(mux)
+
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *FakeCopilot) Endpoints() CopilotEndpoints {
+	return CopilotEndpoints{
+		TokenURL:      f.URL + "/copilot_internal/v2/token",
+		CompletionURL: f.URL + "/chat/completions",
+		ModelsURL:     f.URL + "/models",
+	}
+}
+
+func fakeModel(id string, kind string, contextWindow int, maxOutput int) CopilotModel {
+	model := CopilotModel{ID: id, Name: strings.ToUpper(id), Vendor: "Azure OpenAI"}
+	model.Capabilities.Type = kind
+	model.Capabilities.Tokenizer = "o200k_base"
+	model.Capabilities.Limits.MaxContextWindowTokens = contextWindow
+	model.Capabilities.Limits.MaxPromptTokens = contextWindow - maxOutput
+	model.Capabilities.Limits.MaxOutputTokens = maxOutput
+	model.Capabilities.Supports.Streaming = true
+
+	return model
+}
+
+func (f *FakeCopilot) handleToken(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	delay := f.TokenDelay
+	f.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.TokenRequests++
+
+	if r.Header.Get("authorization") != "token "+FAKE_OAUTH_TOKEN {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"message":"Bad credentials"}`)
+
+		return
+	}
+
+	if f.TokenStatus != 0 {
+		w.WriteHeader(f.TokenStatus)
+
+		return
+	}
+
+	f.tokens++
+	f.token = fmt.Sprintf("tid=%d;exp=%d;chat=1", f.tokens, time.Now().Add(f.TokenTTL).Unix())
+
+	json.NewEncoder(w).Encode(TokenResponse{Token: f.token})
+}
+
+func (f *FakeCopilot) handleModels(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.token == "" || r.Header.Get("authorization") != "Bearer "+f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	if f.ModelsStatus != 0 {
+		w.WriteHeader(f.ModelsStatus)
+
+		return
+	}
+
+	json.NewEncoder(w).Encode(CopilotModelsResponse{Data: f.Models})
+}
+
+func (f *FakeCopilot) handleCompletion(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+
+	var body Request
+
+	json.NewDecoder(r.Body).Decode(&body)
+
+	f.CompletionHeaders = append(f.CompletionHeaders, r.Header.Clone())
+	f.CompletionBodies = append(f.CompletionBodies, body)
+
+	token := f.token
+	chunks := f.Chunks
+	delay := f.Delay
+	status := f.CompletionStatus
+	errorBody := f.CompletionBody
+	retryAfter := f.RetryAfter
+
+	if len(f.Failures) > 0 {
+		status = f.Failures[0]
+		errorBody = `{"error":{"code":"unavailable","message":"try again"}}`
+		f.Failures = f.Failures[1:]
+	}
+
+	f.mu.Unlock()
+
+	if token == "" || r.Header.Get("authorization") != "Bearer "+token || extractExpiration(token) <= time.Now().Unix() {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":{"code":"unauthorized","message":"unauthorized: token expired"}}`)
+
+		return
+	}
+
+	if status != 0 {
+		if retryAfter != "" {
+			w.Header().Set("retry-after", retryAfter)
+		}
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, errorBody)
+
+		return
+	}
+
+	w.Header().Set("content-type", "text/event-stream")
+
+	for _, chunk := range chunks {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(delay):
+		}
+
+		content, _ := json.Marshal(chunk)
+
+		fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":%s}}]}\n\n", content)
+
+		w.(http.Flusher).Flush()
+	}
+
+	fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"finish_reason\":\"stop\",\"delta\":{\"content\":null}}]}\n\n")
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+const FAKE_OAUTH_TOKEN = "gho_fake"
+
+// setConfigHome points $HOME, $XDG_CONFIG_HOME and $XDG_CACHE_HOME to an
+// empty directory.
+func setConfigHome(t *testing.T) string {
+	home := t.TempDir()
+
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, ".cache"))
+
+	return home
+}
+
+// writeTestConfig writes content to the given file of the Copilot config dir.
+func writeTestConfig(t *testing.T, name string, content string) {
+	if err := os.MkdirAll(configDir(), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(configDir(), name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeHostsFile points $HOME to a directory containing a valid hosts.json.
+func writeHostsFile(t *testing.T) {
+	setConfigHome(t)
+
+	writeTestConfig(t, "hosts.json", `{"github.com":{"user":"octocat","oauth_token":"`+FAKE_OAUTH_TOKEN+`"}}`)
+}
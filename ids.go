@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// gopilotConfigDir is where gopilot keeps its own settings.
+func gopilotConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gopilot")
+	}
+
+	return filepath.Join(os.Getenv("HOME"), ".config", "gopilot")
+}
+
+func machineIDPath() string {
+	return filepath.Join(gopilotConfigDir(), "machine-id")
+}
+
+func randomHex(size int) string {
+	bytes := make([]byte, size)
+
+	// crypto/rand never fails on the supported platforms
+	rand.Read(bytes)
+
+	return hex.EncodeToString(bytes)
+}
+
+// uuid is a random RFC 4122 version 4 UUID.
+func uuid() string {
+	b := make([]byte, 16)
+
+	rand.Read(b)
+
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// machineID is generated on the first run and stored next to the settings,
+// like the editors do. When it cannot be stored a new one is used every run.
+func machineID() string {
+	path := machineIDPath()
+
+	content, err := os.ReadFile(path)
+
+	if id := strings.TrimSpace(string(content)); err == nil && isMachineID(id) {
+		return id
+	}
+
+	id := randomHex(32)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Println("Cannot store the machine ID:", err)
+
+		return id
+	}
+
+	if err := os.WriteFile(path, []byte(id+"\n"), 0600); err != nil {
+		log.Println("Cannot store the machine ID:", err)
+	}
+
+	return id
+}
+
+func isMachineID(id string) bool {
+	_, err := hex.DecodeString(id)
+
+	return err == nil && len(id) == 64
+}
+
+// sessionID is a UUID followed by the time in milliseconds, as sent by VSCode.
+func sessionID() string {
+	return uuid() + fmt.Sprint(time.Now().UnixMilli())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+
+	for i := 0; i < 100; i++ {
+		id := uuid()
+
+		if !pattern.MatchString(id) {
+			t.Errorf("got %s want a version 4 UUID", id)
+		}
+
+		if seen[id] {
+			t.Errorf("got %s twice", id)
+		}
+
+		seen[id] = true
+	}
+}
+
+func TestMachineID(t *testing.T) {
+	setConfigHome(t)
+
+	id := machineID()
+
+	if !isMachineID(id) {
+		t.Errorf("got %s want 64 hex characters", id)
+	}
+
+	if machineID() != id {
+		t.Errorf("got a new machine ID on the second run")
+	}
+
+	info, err := os.Stat(machineIDPath())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got %o want %o", info.Mode().Perm(), 0600)
+	}
+
+	// A broken file is replaced
+	os.WriteFile(machineIDPath(), []byte("not an id"), 0600)
+
+	if got := machineID(); got == id || !isMachineID(got) {
+		t.Errorf("got %s want a new machine ID", got)
+	}
+}
+
+func TestCopilotProviderIdentifiers(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	sendHi(t, provider)
+	sendHi(t, provider)
+
+	provider.ResetSession()
+
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+	sendHi(t, provider)
+
+	first, second, other, cleared := fake.CompletionHeaders[0], fake.CompletionHeaders[1], fake.CompletionHeaders[2], fake.CompletionHeaders[3]
+
+	if first.Get("x-request-id") == second.Get("x-request-id") {
+		t.Errorf("The request ID was reused")
+	}
+
+	if first.Get("vscode-sessionid") != second.Get("vscode-sessionid") {
+		t.Errorf("The session ID changed between requests")
+	}
+
+	if first.Get("vscode-sessionid") == cleared.Get("vscode-sessionid") {
+		t.Errorf("The session ID did not change after the reset")
+	}
+
+	// Every run sends the stored machine ID
+	if first.Get("vscode-machineid") != other.Get("vscode-machineid") || first.Get("vscode-machineid") != machineID() {
+		t.Errorf("got %s and %s want %s", first.Get("vscode-machineid"), other.Get("vscode-machineid"), machineID())
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
@@ -22,6 +29,8 @@ var (
 	Program     *tea.Program
 	senderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
 	botStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
+	errorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	markerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Faint(true)
 
 	footerStyle = lipgloss.NewStyle().
 			Height(1).
@@ -37,12 +46,17 @@ type KeyMap struct {
 }
 
 type keyMap struct {
-	Up     key.Binding
-	Down   key.Binding
-	Submit key.Binding
-	Clear  key.Binding
-	Reload key.Binding
-	Quit   key.Binding
+	Up       key.Binding
+	Down     key.Binding
+	Submit   key.Binding
+	Stop     key.Binding
+	Clear    key.Binding
+	Sessions key.Binding
+	Models   key.Binding
+	Settings key.Binding
+	Compact  key.Binding
+	Reload   key.Binding
+	Quit     key.Binding
 }
 
 var keys = keyMap{
@@ -58,10 +72,30 @@ var keys = keyMap{
 		key.WithKeys("ctrl+j"),
 		key.WithHelp("ctrl+j", "send message"),
 	),
+	Stop: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "stop generating"),
+	),
 	Clear: key.NewBinding(
 		key.WithKeys("ctrl+l"),
 		key.WithHelp("ctrl+l", "clear chat history"),
 	),
+	Sessions: key.NewBinding(
+		key.WithKeys("ctrl+o"),
+		key.WithHelp("ctrl+o", "browse saved sessions"),
+	),
+	Models: key.NewBinding(
+		key.WithKeys("ctrl+g"),
+		key.WithHelp("ctrl+g", "switch model"),
+	),
+	Settings: key.NewBinding(
+		key.WithKeys("ctrl+s"),
+		key.WithHelp("ctrl+s", "generation settings"),
+	),
+	Compact: key.NewBinding(
+		key.WithKeys("ctrl+x"),
+		key.WithHelp("ctrl+x", "compact conversation"),
+	),
 	Reload: key.NewBinding(
 		key.WithKeys("ctrl+r"),
 		key.WithHelp("ctrl+r", "(debug) reload copilot token"),
@@ -83,38 +117,55 @@ type HistoryMessage struct {
 }
 
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Submit, k.Up, k.Down, k.Quit, k.Clear, k.Reload}
+	return []key.Binding{k.Submit, k.Stop, k.Up, k.Down, k.Quit, k.Clear, k.Sessions, k.Models, k.Settings, k.Compact, k.Reload}
 }
 
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Up, k.Down, k.Submit, k.Quit}, // first column
-		{k.Clear, k.Reload},              // second column
+		{k.Up, k.Down, k.Submit, k.Stop, k.Quit},                         // first column
+		{k.Clear, k.Sessions, k.Models, k.Settings, k.Compact, k.Reload}, // second column
 	}
 }
 
 type model struct {
-	messages       []HistoryMessage
-	history        []HistoryMessage
-	textarea       textarea.Model
-	viewport       viewport.Model
-	copilotRequest CopilotRequest
-	answering      bool
-	keys           keyMap
-	help           help.Model
-	ready          bool
-	width          int
-}
-
-func initialModel() model {
+	messages  []HistoryMessage
+	history   []HistoryMessage
+	textarea  textarea.Model
+	viewport  viewport.Model
+	provider  Provider
+	answering bool
+	cancel    context.CancelFunc
+	keys      keyMap
+	help      help.Model
+	ready     bool
+	width     int
+	height    int
+	session   Session
+	browser   browser
+	browsing  bool
+	picker    list.Model
+	picking   bool
+	settings  settings
+	// editingSettings is true while the settings panel is open
+	editingSettings bool
+	// compacting is true while the older turns are being summarized
+	compacting bool
+	// placeholder is the message the answer or the summary is shown in, other
+	// messages can be added after it meanwhile
+	placeholder int
+	// request is the number of the last answer or compaction requested
+	request int
+}
+
+func initialModel(provider Provider) model {
 	ta := textarea.New()
 	ta.Placeholder = "Write your query..."
 	ta.Focus()
 
 	ta.Prompt = "┃ "
-	ta.CharLimit = 1000
+	ta.CharLimit = appConfig.UI.CharLimit
 
-	ta.SetHeight(4)
+	ta.SetHeight(appConfig.UI.InputHeight)
 
 	ta.ShowLineNumbers = true
 
@@ -123,13 +174,14 @@ func initialModel() model {
 
 	initialModel := model{
 		messages: []HistoryMessage{
-			createBotHistoryEntry("How can I assist you today?"),
+			createBotHistoryEntry(GREETING),
 		},
-		textarea:       ta,
-		copilotRequest: generateCopilotRequest(),
-		answering:      false,
-		keys:           keys,
-		help:           help.New(),
+		textarea:  ta,
+		provider:  provider,
+		session:   newSession(),
+		answering: false,
+		keys:      keys,
+		help:      help.New(),
 	}
 
 	initialModel.history = append(initialModel.history, createSystemHistoryEntry(SYSTEM_PROMPT))
@@ -148,6 +200,18 @@ func (m model) headerView() string {
 }
 
 func (m model) View() string {
+	if m.browsing {
+		return m.browser.View()
+	}
+
+	if m.picking {
+		return m.picker.View()
+	}
+
+	if m.editingSettings {
+		return m.settings.View()
+	}
+
 	var views []string
 
 	views = append(views, m.viewport.View())
@@ -184,11 +248,49 @@ func createSystemHistoryEntry(msg string) HistoryMessage {
 	}
 }
 
+// createErrorHistoryEntry is only meant for m.messages, errors are never sent
+// back to the provider.
+func createErrorHistoryEntry(msg string) HistoryMessage {
+	return HistoryMessage{
+		Content: msg,
+		Role:    "error",
+	}
+}
+
+const INTERRUPTED_MARKER = "\n\n*[interrupted]*"
+
+// GREETING is the first message of every conversation.
+const GREETING = "How can I assist you today?"
+
 type LoadingMsg struct{}
 type ResponseMsg struct{}
+
+// AnswerMsg is a partial or the final reply. The messages of a request carry
+// its number, the ones of an older request that arrive late are ignored.
 type AnswerMsg struct {
-	content string
-	done    bool
+	request     int
+	content     string
+	done        bool
+	interrupted bool
+}
+
+// ErrorMsg is shown in the chat, the conversation is left as it is.
+type ErrorMsg struct {
+	err error
+}
+
+// FailedMsg is the failure of the answer or the compaction in progress. The
+// turn is rolled back unless part of the answer was already streamed, which is
+// kept as an interrupted answer.
+type FailedMsg struct {
+	request int
+	err     error
+	partial string
+}
+type RetryMsg struct {
+	request  int
+	attempt  int
+	attempts int
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -197,6 +299,36 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds []tea.Cmd
 	)
 
+	if m.browsing {
+		m, cmd = m.updateBrowser(msg)
+
+		if _, ok := msg.(tea.KeyMsg); ok {
+			return m, cmd
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	if m.picking {
+		m, cmd = m.updatePicker(msg)
+
+		if _, ok := msg.(tea.KeyMsg); ok {
+			return m, cmd
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	if m.editingSettings {
+		m, cmd = m.updateSettings(msg)
+
+		if _, ok := msg.(tea.KeyMsg); ok {
+			return m, cmd
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
 	m.textarea, cmd = m.textarea.Update(msg)
 	cmds = append(cmds, cmd)
 
@@ -216,7 +348,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		cmds = append(cmds, func() tea.Msg { return ResponseMsg{} })
 
 	case AnswerMsg:
-		m.messages[len(m.messages)-1].Content = msg.content
+		// The conversation was cleared or the answer belongs to an older request
+		if !m.answering || msg.request != m.request {
+			break
+		}
+
+		if msg.interrupted {
+			msg.content += INTERRUPTED_MARKER
+		}
+
+		m.messages[m.placeholder].Content = msg.content
 
 		str := renderMessages(m.messages, m.width)
 
@@ -225,43 +366,136 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport.GotoBottom()
 
 		if msg.done {
+			m.answering = false
+			m.cancel = nil
+
+			m.history = append(m.history, createBotHistoryEntry(msg.content))
+
 			m.textarea.Reset()
 
+			cmds = append(cmds, m.persist())
+
+			break
+		}
+
+	case ErrorMsg:
+		log.Println("Error:", msg.err)
+
+		m = m.showError(msg.err)
+
+	case FailedMsg:
+		log.Println("Error:", msg.err)
+
+		if msg.request != m.request {
 			break
 		}
 
+		if m.compacting {
+			m.answering = false
+			m.compacting = false
+			m.cancel = nil
+
+			// Remove the "Compacting..." placeholder, the history is untouched
+			m.messages = slices.Delete(m.messages, m.placeholder, m.placeholder+1)
+		} else if m.answering && msg.partial != "" {
+			m.answering = false
+			m.cancel = nil
+
+			content := msg.partial + INTERRUPTED_MARKER
+
+			m.messages[m.placeholder].Content = content
+			m.history = append(m.history, createBotHistoryEntry(content))
+
+			m.textarea.Reset()
+
+			cmds = append(cmds, m.persist())
+		} else if m.answering {
+			m.answering = false
+			m.cancel = nil
+
+			// Replace the "Thinking..." placeholder and give the query back so the
+			// user can retry it.
+			m.messages = slices.Delete(m.messages, m.placeholder, m.placeholder+1)
+
+			last := m.history[len(m.history)-1]
+			m.history = m.history[:len(m.history)-1]
+
+			m.textarea.SetValue(last.Content)
+		}
+
+		m = m.showError(msg.err)
+
+	case CompactedMsg:
+		m, cmd = m.compacted(msg)
+		cmds = append(cmds, cmd)
+
+	case RetryMsg:
+		if !m.answering || msg.request != m.request {
+			break
+		}
+
+		// Replaces the "Thinking..." placeholder, nothing was streamed yet
+		m.messages[m.placeholder].Content = fmt.Sprintf("retrying (%d/%d)...", msg.attempt, msg.attempts)
+
+		m.viewport.SetContent(renderMessages(m.messages, m.width))
+
+		m.viewport.GotoBottom()
+
+	case ModelsMsg:
+		current := ""
+
+		if switcher, ok := m.provider.(ModelSwitcher); ok {
+			current = switcher.Model().ID
+		}
+
+		m.picker = newModelPicker(msg.models, current, m.width, m.height)
+		m.picking = true
+
 	case ResponseMsg:
 		if m.answering {
 			break
 		}
 
-		m.messages = append(m.messages, createBotHistoryEntry("Thinking..."))
+		m = m.fitParams()
 
-		cmds = append(cmds, func() tea.Msg {
-			getResponse(&m, func(reply string, done bool, isError bool) {
+		m.answering = true
+		m.request++
 
-				if done && !isError {
-					m.answering = false
+		m.messages = append(m.messages, createBotHistoryEntry("Thinking..."))
+		m.placeholder = len(m.messages) - 1
 
-					return
-				}
+		if tunable, ok := m.provider.(Tunable); ok {
+			tunable.SetParams(m.session.Params.orDefault())
+		}
 
-				Program.Send(AnswerMsg{content: reply, done: true})
-			})
+		ctx, cancel := context.WithCancel(context.Background())
+		m.cancel = cancel
 
-			m.answering = true
+		history, dropped := m.promptHistory()
 
-			return nil
-		})
+		if dropped > 0 {
+			log.Printf("Not sending the %d oldest messages to fit in the context window", dropped)
+		}
+
+		cmds = append(cmds, askProvider(ctx, m.provider, history, m.request))
 
 	case tea.WindowSizeMsg:
 		footerHeight := lipgloss.Height(m.footerView())
 		viewportHeight := msg.Height - footerHeight - lipgloss.Height(m.helpView())
 
 		m.width = msg.Width
+		m.height = msg.Height
 
 		m.textarea.SetWidth(msg.Width)
 
+		if m.browsing {
+			m.browser.setSize(msg.Width, msg.Height)
+		}
+
+		if m.picking {
+			m.picker.SetSize(msg.Width, msg.Height)
+		}
+
 		if !m.ready {
 			m.ready = true
 
@@ -282,20 +516,69 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.keys.Quit):
 			return m, tea.Quit
 
+		case key.Matches(msg, m.keys.Stop):
+			if m.answering && m.cancel != nil {
+				m.cancel()
+			}
+
 		case key.Matches(msg, m.keys.Clear):
+			if m.cancel != nil {
+				m.cancel()
+			}
+
+			m.answering = false
+			m.compacting = false
+			m.cancel = nil
+
 			m.history = m.history[:1]
 			m.messages = m.messages[:1]
 
+			// The generation settings are kept for the new conversation
+			params := m.session.Params
+			m.session = newSession()
+			m.session.Params = params
+
+			if resetter, ok := m.provider.(SessionResetter); ok {
+				resetter.ResetSession()
+			}
+
 			m.viewport.GotoBottom()
 
 			str := renderMessages(m.messages, m.width)
 			m.viewport.SetContent(str)
 
+		case key.Matches(msg, m.keys.Sessions):
+			sessions, err := listSessions()
+
+			if err != nil {
+				cmds = append(cmds, func() tea.Msg { return ErrorMsg{err: err} })
+
+				break
+			}
+
+			m.browser = newBrowser(sessions, m.width, m.height)
+			m.browsing = true
+
+		case key.Matches(msg, m.keys.Models):
+			if switcher, ok := m.provider.(ModelSwitcher); ok {
+				cmds = append(cmds, listModels(switcher))
+			}
+
+		case key.Matches(msg, m.keys.Settings):
+			m, cmd = m.openSettings()
+			cmds = append(cmds, cmd)
+
+		case key.Matches(msg, m.keys.Compact):
+			m, cmd = m.compact()
+			cmds = append(cmds, cmd)
+
 		case key.Matches(msg, m.keys.Reload):
-			m.copilotRequest = generateCopilotRequest()
+			if reloader, ok := m.provider.(Reloader); ok {
+				cmds = append(cmds, reloadProvider(reloader))
+			}
 
 		case key.Matches(msg, m.keys.Submit):
-			if m.textarea.Value() != "" {
+			if m.textarea.Value() != "" && !m.answering {
 				cmds = append(cmds, func() tea.Msg { return LoadingMsg{} })
 			}
 		}
@@ -304,17 +587,213 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// askProvider streams the partial replies to the running program and returns
+// the final one as the resulting message. A cancelled answer keeps whatever
+// was received so far.
+func askProvider(ctx context.Context, provider Provider, history []HistoryMessage, request int) tea.Cmd {
+	return func() tea.Msg {
+		ctx := WithRetryHook(ctx, func(attempt int, attempts int) {
+			Program.Send(RetryMsg{request: request, attempt: attempt, attempts: attempts})
+		})
+
+		partial := ""
+
+		completion, err := provider.Send(ctx, history, func(reply string, done bool, isError bool) {
+			if done {
+				return
+			}
+
+			if !isError {
+				partial = reply
+			}
+
+			Program.Send(AnswerMsg{request: request, content: reply})
+		})
+
+		if errors.Is(err, context.Canceled) {
+			return AnswerMsg{request: request, content: completion.Content, done: true, interrupted: true}
+		}
+
+		if err != nil {
+			return FailedMsg{request: request, err: err, partial: partial}
+		}
+
+		return AnswerMsg{request: request, content: completion.Content, done: true}
+	}
+}
+
+// showError adds the error at the end of the chat.
+func (m model) showError(err error) model {
+	m.messages = append(m.messages, createErrorHistoryEntry(err.Error()))
+
+	str := renderMessages(m.messages, m.width)
+
+	m.viewport.SetContent(str)
+
+	m.viewport.GotoBottom()
+
+	return m
+}
+
+// persist copies the conversation into the session and saves it to disk.
+func (m *model) persist() tea.Cmd {
+	if m.session.Title == "" {
+		m.session.Title = sessionTitle(m.history)
+	}
+
+	m.session.UpdatedAt = time.Now()
+	m.session.Messages = append([]HistoryMessage(nil), m.messages...)
+	m.session.History = append([]HistoryMessage(nil), m.history...)
+
+	session := m.session
+
+	if !session.hasConversation() {
+		return nil
+	}
+
+	return func() tea.Msg {
+		if err := saveSession(session); err != nil {
+			return ErrorMsg{err: err}
+		}
+
+		return nil
+	}
+}
+
+// preload adds some context, like piped input, to the conversation before the
+// first question.
+func (m model) preload(content string) model {
+	m.history = append(m.history, createHistoryEntry(content))
+	m.messages = append(m.messages, createHistoryEntry(content))
+
+	return m
+}
+
+// resumeSession replaces the current conversation with a saved one.
+func (m model) resumeSession(session Session) model {
+	if m.cancel != nil {
+		m.cancel()
+	}
+
+	m.answering = false
+	m.compacting = false
+	m.cancel = nil
+
+	m.session = session
+	m.session.Params = session.Params.orDefault()
+
+	if resetter, ok := m.provider.(SessionResetter); ok {
+		resetter.ResetSession()
+	}
+
+	m.messages = append([]HistoryMessage(nil), session.Messages...)
+	m.history = append([]HistoryMessage(nil), session.History...)
+
+	m.textarea.Reset()
+
+	str := renderMessages(m.messages, m.width)
+	m.viewport.SetContent(str)
+
+	m.viewport.GotoBottom()
+
+	return m
+}
+
+func reloadProvider(reloader Reloader) tea.Cmd {
+	return func() tea.Msg {
+		if err := reloader.Reload(context.Background()); err != nil {
+			return ErrorMsg{err: err}
+		}
+
+		return nil
+	}
+}
+
+// modelInfo returns the selected model, empty when the provider cannot tell.
+func (m model) modelInfo() ModelInfo {
+	if switcher, ok := m.provider.(ModelSwitcher); ok {
+		return switcher.Model()
+	}
+
+	return ModelInfo{}
+}
+
+// promptHistory is the part of the history that fits in the context window
+// of the model, together with how many old messages were left out.
+func (m model) promptHistory() ([]HistoryMessage, int) {
+	budget := promptBudget(m.modelInfo(), m.session.Params.orDefault())
+
+	return truncateHistory(m.history, budget)
+}
+
+// usageView shows the model and how much of its context window is used.
+func (m model) usageView() string {
+	history, dropped := m.promptHistory()
+	budget := promptBudget(m.modelInfo(), m.session.Params.orDefault())
+
+	usage := fmt.Sprintf("%s/%s tokens", formatTokens(historyTokens(history)), formatTokens(budget))
+
+	if dropped > 0 {
+		usage += fmt.Sprintf(", %d old messages left out", dropped)
+	}
+
+	if model := m.modelInfo(); model.ID != "" {
+		usage = model.ID + " · " + usage
+	}
+
+	return " " + usage + " "
+}
+
 func (m model) footerView() string {
-	line := strings.Repeat("─", m.viewport.Width)
+	// Show the usage on the right of the separator
+	label := m.usageView()
+	line := strings.Repeat("─", max(m.viewport.Width-lipgloss.Width(label)-1, 0)) + label + "─"
 
 	return lipgloss.JoinVertical(lipgloss.Bottom, line, m.textarea.View())
 }
 
 func main() {
+	commands := map[string]func([]string) error{
+		"serve":  runServe,
+		"login":  runLogin,
+		"logout": runLogout,
+		"status": runStatus,
+	}
+
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+			fmt.Println(err)
+
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	debug := flag.Bool("d", false, "Enable debug mode")
+	providerName := flag.String("provider", "", "Chat backend: copilot, openai or ollama, defaults to the config file or copilot")
+	baseURL := flag.String("base-url", "", "Base URL of the openai or ollama endpoint")
+	apiKey := flag.String("api-key", "", "API key of the openai endpoint")
+	modelName := flag.String("model", "", "Model name, copilot defaults to $COPILOT_MODEL, the config file or "+DEFAULT_COPILOT_MODEL)
+	account := flag.String("account", "", "GitHub account of the copilot provider, a user, a host or user@host, defaults to $COPILOT_ACCOUNT")
+	resume := flag.Bool("resume", false, "Resume the most recent session")
+	sessionID := flag.String("session", "", "Resume the session with the given id")
+	prompt := flag.String("p", "", "Ask a single question and print the answer to stdout")
+	render := flag.Bool("render", false, "Render the answer of -p with glamour instead of printing it raw")
+	output := flag.String("output", OUTPUT_TEXT, "Output format of -p: text, json or ndjson")
+	record := flag.String("record", "", "Record every API request and response to the given JSONL file")
+	replay := flag.String("replay", "", "Answer with the responses recorded in the given JSONL file instead of calling the API")
+
+	config := configFlag(flag.CommandLine)
 
 	flag.Parse()
 
+	if err := useConfig(*config); err != nil {
+		fmt.Println(err)
+
+		os.Exit(1)
+	}
+
 	if *debug {
 		file, err := os.OpenFile("gopilot.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 
@@ -329,7 +808,104 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
+	if *record != "" {
+		file, err := os.OpenFile(*record, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer file.Close()
+
+		httpTransport = NewRecorder(file, http.DefaultTransport)
+	}
+
+	var provider Provider
+	var err error
+
+	if *replay != "" {
+		provider, err = NewReplayProvider(*replay)
+	} else {
+		provider, err = newProvider(ProviderConfig{
+			Name:    firstNonEmpty(*providerName, appConfig.Provider),
+			BaseURL: *baseURL,
+			APIKey:  *apiKey,
+			Model:   *modelName,
+			Account: *account,
+		})
+	}
+
+	if err != nil {
+		fmt.Println(err)
+
+		os.Exit(1)
+	}
+
+	input := ""
+
+	// stdin is only read when asked for, an inherited one might never be closed
+	if *prompt != "" || flag.Arg(0) == "-" {
+		input, err = readPipedInput(os.Stdin)
+
+		if err != nil {
+			fmt.Println("Cannot read stdin:", err)
+
+			os.Exit(1)
+		}
+	}
+
+	if !validOutput(*output) {
+		fmt.Printf("Unknown output format %q\n", *output)
+
+		os.Exit(1)
+	}
+
+	if *prompt != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+
+		err := runPrompt(ctx, provider, attachInput(*prompt, input), PromptOptions{Render: *render, Output: *output}, os.Stdout)
+
+		stop()
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	m := initialModel(provider)
+
+	if *resume || *sessionID != "" {
+		var session Session
+
+		if *sessionID != "" {
+			session, err = loadSession(*sessionID)
+		} else {
+			session, err = latestSession()
+		}
+
+		if err != nil {
+			fmt.Println("Cannot resume the session:", err)
+
+			os.Exit(1)
+		}
+
+		m = m.resumeSession(session)
+	}
+
+	options := []tea.ProgramOption{tea.WithAltScreen()}
+
+	if piped := attachInput("", input); piped != "" {
+		m = m.preload(piped)
+
+		// stdin is the pipe, read the keyboard from the terminal instead
+		options = append(options, tea.WithInputTTY())
+	}
+
+	p := tea.NewProgram(m, options...)
 
 	Program = p
 
@@ -361,6 +937,14 @@ func renderUserText(str string, width int) string {
 	return senderStyle.Render("You: ") + renderText(str, width)
 }
 
+func renderErrorText(str string, width int) string {
+	return errorStyle.Render("Error: "+wrap.String(str, width)) + "\n\n"
+}
+
+func renderMarkerText(str string, width int) string {
+	return markerStyle.Render("── "+wrap.String(str, width)+" ──") + "\n\n"
+}
+
 func renderMessages(messages []HistoryMessage, width int) string {
 	wrappedStrings := make([]string, len(messages))
 
@@ -375,6 +959,16 @@ func renderMessages(messages []HistoryMessage, width int) string {
 			continue
 		}
 
+		if message.Role == "error" {
+			wrappedStrings[i] = renderErrorText(message.Content, width)
+			continue
+		}
+
+		if message.Role == "compacted" {
+			wrappedStrings[i] = renderMarkerText(message.Content, width)
+			continue
+		}
+
 		wrappedStrings[i] = renderText(message.Content, width)
 	}
 
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type FakeProvider struct {
+	chunks  []string
+	reply   string
+	err     error
+	history []HistoryMessage
+	params  GenerationParams
+	resets  int
+}
+
+func (f *FakeProvider) ResetSession() {
+	f.resets++
+}
+
+func (f *FakeProvider) SetParams(params GenerationParams) {
+	f.params = params
+}
+
+func (f *FakeProvider) Send(ctx context.Context, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error) {
+	f.history = history
+
+	partial := ""
+
+	for _, chunk := range f.chunks {
+		partial += chunk
+
+		callback(partial, false, false)
+	}
+
+	callback(f.reply, true, f.err != nil)
+
+	return Completion{Content: f.reply, FinishReason: "stop"}, f.err
+}
+
+func TestAskProvider(t *testing.T) {
+	provider := &FakeProvider{reply: "hello"}
+	history := []HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("hi")}
+
+	msg := askProvider(context.Background(), provider, history, 1)()
+
+	answer, ok := msg.(AnswerMsg)
+
+	if !ok {
+		t.Fatalf("got %T want AnswerMsg", msg)
+	}
+
+	if answer.content != "hello" {
+		t.Errorf("got %s want %s", answer.content, "hello")
+	}
+
+	if !answer.done {
+		t.Errorf("Not finished")
+	}
+
+	if len(provider.history) != len(history) {
+		t.Errorf("got %d want %d", len(provider.history), len(history))
+	}
+}
+
+func TestAskProviderError(t *testing.T) {
+	provider := &FakeProvider{err: errors.New("boom")}
+
+	msg := askProvider(context.Background(), provider, []HistoryMessage{createHistoryEntry("hi")}, 1)()
+
+	errorMsg, ok := msg.(FailedMsg)
+
+	if !ok {
+		t.Fatalf("got %T want FailedMsg", msg)
+	}
+
+	if errorMsg.err.Error() != "boom" {
+		t.Errorf("got %s want %s", errorMsg.err, "boom")
+	}
+}
+
+func TestUpdateAnswer(t *testing.T) {
+	m := initialModel(&FakeProvider{reply: "hello"})
+
+	updated, _ := m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	if !m.answering {
+		t.Errorf("Not answering")
+	}
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	if len(m.messages) != 2 {
+		t.Errorf("got %d want %d", len(m.messages), 2)
+	}
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hello", done: true})
+	m = updated.(model)
+
+	if m.answering {
+		t.Errorf("Still answering")
+	}
+
+	if m.messages[1].Content != "hello" {
+		t.Errorf("got %s want %s", m.messages[1].Content, "hello")
+	}
+}
+
+func TestUpdateError(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(FailedMsg{request: m.request, err: newError(ErrorNetwork, "offline", nil)})
+	m = updated.(model)
+
+	if m.answering {
+		t.Errorf("Still answering")
+	}
+
+	if len(m.history) != 1 {
+		t.Errorf("got %d want %d", len(m.history), 1)
+	}
+
+	last := m.messages[len(m.messages)-1]
+
+	if last.Role != "error" {
+		t.Errorf("got %s want %s", last.Role, "error")
+	}
+
+	if m.textarea.Value() != "hi" {
+		t.Errorf("got %s want %s", m.textarea.Value(), "hi")
+	}
+}
+
+func TestUpdatePartialError(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hel"})
+	m = updated.(model)
+
+	// The stream broke after part of the answer was shown
+	updated, _ = m.Update(FailedMsg{request: m.request, err: newError(ErrorNetwork, "the response was interrupted", nil), partial: "hel"})
+	m = updated.(model)
+
+	if m.answering {
+		t.Errorf("Still answering")
+	}
+
+	want := []string{"system", "user", "assistant"}
+
+	if strings.Join(roles(m.history), " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", roles(m.history), want)
+	}
+
+	if m.history[2].Content != "hel"+INTERRUPTED_MARKER {
+		t.Errorf("got %s want %s", m.history[2].Content, "hel"+INTERRUPTED_MARKER)
+	}
+
+	if m.messages[len(m.messages)-1].Role != "error" || m.messages[len(m.messages)-2].Content != "hel"+INTERRUPTED_MARKER {
+		t.Errorf("got %v want the partial answer followed by the error", roles(m.messages))
+	}
+
+	if m.textarea.Value() != "" {
+		t.Errorf("got %s want an empty input", m.textarea.Value())
+	}
+}
+
+func TestUpdateUnrelatedError(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hel"})
+	m = updated.(model)
+
+	// For instance the models cannot be listed while answering
+	updated, _ = m.Update(ErrorMsg{err: errors.New("cannot list the models")})
+	m = updated.(model)
+
+	if !m.answering {
+		t.Errorf("The answer was stopped")
+	}
+
+	if len(m.history) != 2 {
+		t.Errorf("got %d want %d", len(m.history), 2)
+	}
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hello", done: true})
+	m = updated.(model)
+
+	want := []string{"system", "user", "assistant"}
+
+	if strings.Join(roles(m.history), " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", roles(m.history), want)
+	}
+
+	// The error stays in the chat, the answer goes where the placeholder was
+	if m.messages[len(m.messages)-1].Role != "error" || m.messages[len(m.messages)-2].Content != "hello" {
+		t.Errorf("got %v want the answer followed by the error", roles(m.messages))
+	}
+}
+
+func TestUpdateRetry(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(RetryMsg{request: m.request, attempt: 2, attempts: 3})
+	m = updated.(model)
+
+	if m.messages[len(m.messages)-1].Content != "retrying (2/3)..." {
+		t.Errorf("got %s want %s", m.messages[len(m.messages)-1].Content, "retrying (2/3)...")
+	}
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hello"})
+	m = updated.(model)
+
+	if m.messages[len(m.messages)-1].Content != "hello" {
+		t.Errorf("got %s want %s", m.messages[len(m.messages)-1].Content, "hello")
+	}
+}
+
+func TestUpdateInterrupted(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	if m.cancel == nil {
+		t.Fatalf("No cancel function")
+	}
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "partial", done: true, interrupted: true})
+	m = updated.(model)
+
+	want := "partial" + INTERRUPTED_MARKER
+
+	if m.messages[len(m.messages)-1].Content != want {
+		t.Errorf("got %s want %s", m.messages[len(m.messages)-1].Content, want)
+	}
+
+	if m.history[len(m.history)-1].Content != want {
+		t.Errorf("got %s want %s", m.history[len(m.history)-1].Content, want)
+	}
+}
+
+func TestPersistAndResume(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	updated, cmd := m.Update(AnswerMsg{request: m.request, content: "hello", done: true})
+	m = updated.(model)
+
+	if m.session.Title != "hi" {
+		t.Errorf("got %s want %s", m.session.Title, "hi")
+	}
+
+	// Run the batched commands so the session gets saved
+	runCmd(cmd)
+
+	session, err := loadSession(m.session.ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := initialModel(&FakeProvider{}).resumeSession(session)
+
+	if len(resumed.history) != 3 || resumed.history[2].Content != "hello" {
+		t.Errorf("got %v want %v", resumed.history, m.history)
+	}
+
+	if len(resumed.messages) != len(m.messages) {
+		t.Errorf("got %d want %d", len(resumed.messages), len(m.messages))
+	}
+}
+
+// cmdMessages runs cmd and returns the messages it produced.
+func cmdMessages(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+
+	msg := cmd()
+
+	if batch, ok := msg.(tea.BatchMsg); ok {
+		var msgs []tea.Msg
+
+		for _, cmd := range batch {
+			msgs = append(msgs, cmdMessages(cmd)...)
+		}
+
+		return msgs
+	}
+
+	return []tea.Msg{msg}
+}
+
+func runCmd(cmd tea.Cmd) {
+	if cmd == nil {
+		return
+	}
+
+	if batch, ok := cmd().(tea.BatchMsg); ok {
+		for _, cmd := range batch {
+			runCmd(cmd)
+		}
+	}
+}
+
+func TestUpdateClear(t *testing.T) {
+	provider := &FakeProvider{}
+	m := initialModel(provider)
+	m = m.preload("hi")
+	id := m.session.ID
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	m = updated.(model)
+
+	if len(m.history) != 1 || len(m.messages) != 1 {
+		t.Errorf("got %d and %d want %d", len(m.history), len(m.messages), 1)
+	}
+
+	if m.session.ID == id {
+		t.Errorf("The session was not restarted")
+	}
+
+	if provider.resets != 1 {
+		t.Errorf("got %d want %d", provider.resets, 1)
+	}
+}
+
+func TestUpdateSubmitWhileAnswering(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("hi")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	// The textarea says "Loading..." until the answer is done
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlJ})
+	m = updated.(model)
+
+	for _, msg := range cmdMessages(cmd) {
+		if _, ok := msg.(LoadingMsg); ok {
+			t.Errorf("A message was sent while answering")
+		}
+	}
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hello", done: true})
+	m = updated.(model)
+
+	want := []string{"system", "user", "assistant"}
+
+	if strings.Join(roles(m.history), " ") != strings.Join(want, " ") {
+		t.Errorf("got %v want %v", roles(m.history), want)
+	}
+
+	last := m.messages[len(m.messages)-1]
+
+	if last.Role != "assistant" || last.Content != "hello" {
+		t.Errorf("got %s %s want %s %s", last.Role, last.Content, "assistant", "hello")
+	}
+}
+
+func TestUpdateLateAnswer(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+	m.textarea.SetValue("first")
+
+	updated, _ := m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	old := m.request
+
+	// The chat is cleared and a new question is asked before the first answer ends
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	m = updated.(model)
+
+	m.textarea.SetValue("second")
+
+	updated, _ = m.Update(LoadingMsg{})
+	m = updated.(model)
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	for _, msg := range []tea.Msg{
+		AnswerMsg{request: old, content: "stale"},
+		RetryMsg{request: old, attempt: 2, attempts: 3},
+		AnswerMsg{request: old, content: "stale", done: true, interrupted: true},
+		FailedMsg{request: old, err: errors.New("boom")},
+	} {
+		updated, _ = m.Update(msg)
+		m = updated.(model)
+	}
+
+	if !m.answering {
+		t.Errorf("The new answer was stopped")
+	}
+
+	if m.messages[len(m.messages)-1].Content != "Thinking..." {
+		t.Errorf("got %s want %s", m.messages[len(m.messages)-1].Content, "Thinking...")
+	}
+
+	updated, _ = m.Update(AnswerMsg{request: m.request, content: "hello", done: true})
+	m = updated.(model)
+
+	want := []string{"system", "user", "assistant"}
+
+	if strings.Join(roles(m.history), " ") != strings.Join(want, " ") || m.history[1].Content != "second" {
+		t.Errorf("got %v want %v", m.history, want)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const DEFAULT_COPILOT_MODEL = "gpt-4"
+const DEFAULT_MAX_TOKENS = 8192
+
+// CopilotModel is an entry of the Copilot models endpoint.
+type CopilotModel struct {
+	ID                 string `json:"id"`
+	Name               string `json:"name"`
+	Vendor             string `json:"vendor"`
+	Version            string `json:"version"`
+	ModelPickerEnabled bool   `json:"model_picker_enabled"`
+	Capabilities       struct {
+		Family    string `json:"family"`
+		Type      string `json:"type"`
+		Tokenizer string `json:"tokenizer"`
+		Limits    struct {
+			MaxContextWindowTokens int `json:"max_context_window_tokens"`
+			MaxOutputTokens        int `json:"max_output_tokens"`
+			MaxPromptTokens        int `json:"max_prompt_tokens"`
+		} `json:"limits"`
+		Supports struct {
+			Streaming bool `json:"streaming"`
+			ToolCalls bool `json:"tool_calls"`
+			Vision    bool `json:"vision"`
+		} `json:"supports"`
+	} `json:"capabilities"`
+}
+
+type CopilotModelsResponse struct {
+	Data []CopilotModel `json:"data"`
+}
+
+func (m CopilotModel) info() ModelInfo {
+	return ModelInfo{
+		ID:            m.ID,
+		Name:          m.Name,
+		Vendor:        m.Vendor,
+		Tokenizer:     m.Capabilities.Tokenizer,
+		ContextWindow: m.Capabilities.Limits.MaxContextWindowTokens,
+		MaxPrompt:     m.Capabilities.Limits.MaxPromptTokens,
+		MaxOutput:     m.Capabilities.Limits.MaxOutputTokens,
+		Streaming:     m.Capabilities.Supports.Streaming,
+		ToolCalls:     m.Capabilities.Supports.ToolCalls,
+		Vision:        m.Capabilities.Supports.Vision,
+	}
+}
+
+// fetchModels lists the chat models available to the account. c must hold a
+// valid token.
+func fetchModels(ctx context.Context, c *CopilotRequest) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.Endpoints.ModelsURL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	setCopilotHeaders(req, c)
+
+	req.Header.Set("accept", "application/json")
+
+	client := &http.Client{Timeout: appConfig.Timeouts.Request, Transport: httpTransport}
+	resp, err := client.Do(req)
+
+	if err != nil {
+		return nil, newError(ErrorNetwork, "cannot reach the models API", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, "")
+	}
+
+	var response CopilotModelsResponse
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, newError(ErrorAPI, "cannot decode the models", err)
+	}
+
+	models := []ModelInfo{}
+	seen := map[string]bool{}
+
+	for _, model := range response.Data {
+		if model.Capabilities.Type != "chat" || seen[model.ID] {
+			continue
+		}
+
+		seen[model.ID] = true
+		models = append(models, model.info())
+	}
+
+	return models, nil
+}
+
+// Models returns the chat models of the account. The listing is cached, it
+// is only fetched again when the previous attempt failed.
+func (p *CopilotProvider) Models(ctx context.Context) ([]ModelInfo, error) {
+	p.mu.Lock()
+
+	if len(p.models) > 0 {
+		defer p.mu.Unlock()
+
+		return p.models, nil
+	}
+
+	p.mu.Unlock()
+
+	c, err := p.session(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	models, err := fetchModels(ctx, &c)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.modelsLoaded = true
+
+	if err != nil {
+		return nil, err
+	}
+
+	p.models = models
+
+	// Pick up the limits of the selected model
+	if model, ok := findModel(models, p.request.Model.ID); ok {
+		p.request.Model = model
+	}
+
+	return models, nil
+}
+
+// loadModels fetches the models once so the requests use the limits of the
+// selected model, the defaults are kept if the listing is not available.
+func (p *CopilotProvider) loadModels(ctx context.Context) {
+	p.mu.Lock()
+	loaded := p.modelsLoaded
+	p.mu.Unlock()
+
+	if loaded {
+		return
+	}
+
+	if _, err := p.Models(ctx); err != nil {
+		log.Println("Cannot list the models:", err)
+	}
+}
+
+func (p *CopilotProvider) Model() ModelInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.request.Model
+}
+
+// SetModel selects the model of the next requests. The id is only checked
+// once the models have been listed.
+func (p *CopilotProvider) SetModel(id string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.models) == 0 {
+		p.request.Model = ModelInfo{ID: id}
+
+		return nil
+	}
+
+	model, ok := findModel(p.models, id)
+
+	if !ok {
+		return fmt.Errorf("unknown model %q", id)
+	}
+
+	p.request.Model = model
+
+	return nil
+}
+
+func findModel(models []ModelInfo, id string) (ModelInfo, bool) {
+	for _, model := range models {
+		if model.ID == id {
+			return model, true
+		}
+	}
+
+	return ModelInfo{}, false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestCopilotProviderModels(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	models, err := provider.Models(context.Background())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(models) != 2 || models[1].ID != "gpt-4o" || models[1].ContextWindow != 128000 || models[1].MaxOutput != 16384 {
+		t.Errorf("got %+v want the chat models with their limits", models)
+	}
+
+	if err := provider.SetModel("unknown"); err == nil {
+		t.Errorf("got nil want an error for an unknown model")
+	}
+
+	if err := provider.SetModel("gpt-4o"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := fake.CompletionBodies[0]
+
+	if body.Model != "gpt-4o" || body.Maxtokens != 16384 {
+		t.Errorf("got %s with %d max tokens want %s with %d", body.Model, body.Maxtokens, "gpt-4o", 16384)
+	}
+}
+
+func TestCopilotProviderModelLimits(t *testing.T) {
+	tests := []struct {
+		model        string
+		modelsStatus int
+		want         string
+		maxTokens    int
+	}{
+		{"", 0, "gpt-4", 4096},
+		{"gpt-4o", 0, "gpt-4o", 16384},
+		// The defaults are used when the models cannot be listed
+		{"gpt-4o", http.StatusNotFound, "gpt-4o", DEFAULT_MAX_TOKENS},
+		{"", http.StatusInternalServerError, "gpt-4", DEFAULT_MAX_TOKENS},
+	}
+
+	for _, tt := range tests {
+		writeHostsFile(t)
+
+		fake := NewFakeCopilot(t)
+		fake.ModelsStatus = tt.modelsStatus
+
+		provider := NewCopilotProvider(fake.Endpoints())
+
+		if tt.model != "" {
+			provider.SetModel(tt.model)
+		}
+
+		_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body := fake.CompletionBodies[0]
+
+		if body.Model != tt.want || body.Maxtokens != tt.maxTokens {
+			t.Errorf("got %s with %d max tokens want %s with %d", body.Model, body.Maxtokens, tt.want, tt.maxTokens)
+		}
+	}
+}
+
+func TestDescribeModel(t *testing.T) {
+	tests := []struct {
+		model ModelInfo
+		want  string
+	}{
+		{ModelInfo{ID: "gpt-4"}, "gpt-4"},
+		{ModelInfo{ID: "gpt-4o", ContextWindow: 128000, MaxOutput: 16384, ToolCalls: true, Vision: true}, "gpt-4o · 128k context · 16k output · tools · vision"},
+		{ModelInfo{ID: "tiny", ContextWindow: 512}, "tiny · 512 context"},
+	}
+
+	for _, tt := range tests {
+		got := describeModel(tt.model)
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
+
+type FakeSwitcher struct {
+	FakeProvider
+	model  ModelInfo
+	models []ModelInfo
+}
+
+func (f *FakeSwitcher) Models(ctx context.Context) ([]ModelInfo, error) { return f.models, nil }
+func (f *FakeSwitcher) Model() ModelInfo                                { return f.model }
+
+func (f *FakeSwitcher) SetModel(id string) error {
+	f.model = ModelInfo{ID: id}
+
+	if model, ok := findModel(f.models, id); ok {
+		f.model = model
+	}
+
+	return nil
+}
+
+func TestModelPicker(t *testing.T) {
+	switcher := &FakeSwitcher{
+		model:  ModelInfo{ID: "gpt-4"},
+		models: []ModelInfo{{ID: "gpt-4"}, {ID: "gpt-4o"}},
+	}
+
+	m := initialModel(switcher)
+
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	m = updated.(model)
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	m = updated.(model)
+
+	for _, msg := range cmdMessages(cmd) {
+		updated, _ = m.Update(msg)
+		m = updated.(model)
+	}
+
+	if !m.picking {
+		t.Fatalf("The picker is not open")
+	}
+
+	if item := m.picker.SelectedItem().(modelItem); !item.current || item.model.ID != "gpt-4" {
+		t.Errorf("got %+v want the current model selected", item)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = updated.(model)
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	if m.picking || switcher.model.ID != "gpt-4o" {
+		t.Errorf("got %s want %s selected and the picker closed", switcher.model.ID, "gpt-4o")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const OLLAMA_DEFAULT_BASE_URL = "http://localhost:11434"
+
+type OllamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// OllamaOptions are the sampling options, num_predict is the max tokens.
+type OllamaOptions struct {
+	Temperature float32 `json:"temperature"`
+	TopP        float32 `json:"top_p"`
+	NumPredict  int     `json:"num_predict,omitempty"`
+}
+
+type OllamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  OllamaOptions   `json:"options"`
+}
+
+type OllamaResponse struct {
+	Model      string        `json:"model"`
+	Message    OllamaMessage `json:"message"`
+	Done       bool          `json:"done"`
+	DoneReason string        `json:"done_reason"`
+	Error      string        `json:"error"`
+}
+
+// OllamaProvider talks to the native /api/chat endpoint of a local Ollama
+// instance, which streams newline-delimited JSON instead of SSE.
+type OllamaProvider struct {
+	BaseURL string
+	Model   string
+	Params  GenerationParams
+}
+
+// SetParams ignores n, Ollama always gives a single answer.
+func (p *OllamaProvider) SetParams(params GenerationParams) {
+	p.Params = params
+}
+
+func (p *OllamaProvider) Send(ctx context.Context, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error) {
+	body, err := json.Marshal(generateOllamaRequest(p.Model, history, p.Params))
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	url := strings.TrimRight(p.BaseURL, "/") + "/api/chat"
+
+	log.Println("Sending request to:", url)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("accept", "application/x-ndjson")
+
+	resp, err := doCompletionRequest(req)
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := statusError(resp, p.Model)
+
+		callback(err.Message, true, true)
+
+		return Completion{Content: err.Message}, err
+	}
+
+	return parseOllamaResponse(ctx, resp.Body, callback)
+}
+
+func generateOllamaRequest(model string, history []HistoryMessage, params GenerationParams) OllamaRequest {
+	params = params.orDefault()
+
+	messages := make([]OllamaMessage, len(history))
+
+	for i, message := range history {
+		messages[i] = OllamaMessage{Role: message.Role, Content: message.Content}
+	}
+
+	return OllamaRequest{
+		Model:    model,
+		Messages: messages,
+		Stream:   true,
+		Options: OllamaOptions{
+			Temperature: params.Temperature,
+			TopP:        params.TopP,
+			NumPredict:  params.MaxTokens,
+		},
+	}
+}
+
+func parseOllamaResponse(ctx context.Context, s io.ReadCloser, callback func(string, bool, bool)) (Completion, error) {
+	dec := bufio.NewReader(s)
+	isError := false
+	var responseError error
+	var completion Completion
+
+	reply := make([]byte, 0)
+
+	for {
+		content, err := dec.ReadBytes('\n')
+
+		line := strings.TrimSpace(string(content))
+
+		if line != "" {
+			log.Println("Content:", line)
+
+			var message OllamaResponse
+
+			if err := json.Unmarshal([]byte(line), &message); err != nil {
+				isError = true
+				responseError = newError(ErrorAPI, fmt.Sprintf("malformed chunk %q", line), err)
+
+				break
+			}
+
+			if message.Error != "" {
+				reply = []byte(message.Error)
+				isError = true
+				responseError = newError(ErrorAPI, message.Error, nil)
+
+				break
+			}
+
+			if message.Message.Content != "" {
+				reply = append(reply, []byte(message.Message.Content)...)
+
+				callback(string(reply), false, isError)
+			}
+
+			if message.Done {
+				completion.FinishReason = message.DoneReason
+
+				break
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			log.Println("Cannot read the response:", err)
+
+			responseError = newError(ErrorNetwork, "the response was interrupted", err)
+
+			break
+		}
+	}
+
+	callback(string(reply), true, isError)
+
+	log.Println("Reply:", string(reply))
+
+	completion.Content = string(reply)
+
+	if ctx.Err() != nil {
+		return completion, ctx.Err()
+	}
+
+	return completion, responseError
+}
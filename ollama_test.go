@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParseOllamaResponse(t *testing.T) {
+	tests := []struct {
+		input               string
+		want                string
+		isError             bool
+		callbackCalledTimes int
+	}{
+		{`{"model":"llama3","message":{"role":"assistant","content":"hello"},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":" from"},"done":false}
+
+{"model":"llama3","message":{"role":"assistant","content":" here."},"done":false}
+{"model":"llama3","message":{"role":"assistant","content":""},"done":true}
+`, "hello from here.", false, 4},
+		{`{"model":"llama3","message":{"role":"assistant","content":"hello"},"done":true}
+{"model":"llama3","message":{"role":"assistant","content":" again"},"done":false}
+`, "hello", false, 2},
+		{`{"model":"llama3","message":{"role":"assistant","content":"no newline"},"done":false}`, "no newline", false, 2},
+		{"", "", false, 1},
+		{`{"error":"model 'llama3' not found, try pulling it first"}`, "model 'llama3' not found, try pulling it first", true, 1},
+	}
+
+	for _, tt := range tests {
+		mockReader := &MockReadCloser{data: tt.input}
+		totalCalls := 0
+		finished := false
+		isError := false
+
+		got, _ := parseOllamaResponse(context.Background(), mockReader, func(s string, b bool, e bool) {
+			totalCalls++
+
+			finished = b
+			isError = e
+		})
+
+		if totalCalls != tt.callbackCalledTimes {
+			t.Errorf("got %d want %d", totalCalls, tt.callbackCalledTimes)
+		}
+
+		if !finished {
+			t.Errorf("Not finished")
+		}
+
+		if isError != tt.isError {
+			t.Errorf("got %t want %t", isError, tt.isError)
+		}
+
+		if got.Content != tt.want {
+			t.Errorf("got %s want %s", got.Content, tt.want)
+		}
+	}
+}
+
+func TestParseOllamaResponseErrors(t *testing.T) {
+	chunk := `{"model":"llama3","message":{"role":"assistant","content":"hello"},"done":false}` + "\n"
+
+	tests := []struct {
+		body io.Reader
+		kind ErrorKind
+		want string
+	}{
+		{strings.NewReader(chunk + "<html>Bad gateway</html>\n"), ErrorAPI, `malformed chunk "<html>Bad gateway</html>"`},
+		{io.MultiReader(strings.NewReader(chunk), iotest.ErrReader(errors.New("connection reset"))), ErrorNetwork, "the response was interrupted"},
+	}
+
+	for _, tt := range tests {
+		got, err := parseOllamaResponse(context.Background(), io.NopCloser(tt.body), func(string, bool, bool) {})
+
+		if !errors.Is(err, &ProviderError{Kind: tt.kind}) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got %v want %s", err, tt.want)
+		}
+
+		// The partial reply is kept
+		if got.Content != "hello" {
+			t.Errorf("got %s want %s", got.Content, "hello")
+		}
+	}
+}
+
+func TestGenerateOllamaRequest(t *testing.T) {
+	history := []HistoryMessage{
+		createSystemHistoryEntry("system"),
+		createHistoryEntry("hi"),
+		createBotHistoryEntry("hello"),
+	}
+
+	got := generateOllamaRequest("llama3", history, GenerationParams{Temperature: 0.7, TopP: 0.9, MaxTokens: 256, N: 1})
+
+	if got.Model != "llama3" {
+		t.Errorf("got %s want %s", got.Model, "llama3")
+	}
+
+	if got.Options != (OllamaOptions{Temperature: 0.7, TopP: 0.9, NumPredict: 256}) {
+		t.Errorf("got %+v want the generation params as options", got.Options)
+	}
+
+	if !got.Stream {
+		t.Errorf("Not streaming")
+	}
+
+	for i, message := range history {
+		if got.Messages[i].Role != message.Role || got.Messages[i].Content != message.Content {
+			t.Errorf("got %v want %v", got.Messages[i], message)
+		}
+	}
+}
+
+func TestOllamaProviderStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "404 page not found")
+	}))
+
+	defer server.Close()
+
+	provider := &OllamaProvider{BaseURL: server.URL, Model: "llama3"}
+	isError := false
+
+	reply, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(reply string, done bool, e bool) {
+		isError = e
+	})
+
+	if !errors.Is(err, &ProviderError{Kind: ErrorAPI}) {
+		t.Errorf("got %v want %s", err, ErrorAPI)
+	}
+
+	if !isError || !strings.Contains(reply.Content, "llama3") {
+		t.Errorf("got %s want the unknown model error", reply.Content)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const DEFAULT_RENDER_WIDTH = 80
+
+const (
+	OUTPUT_TEXT   = "text"
+	OUTPUT_JSON   = "json"
+	OUTPUT_NDJSON = "ndjson"
+)
+
+type PromptOptions struct {
+	// Render the whole reply with glamour once it is complete, text output only
+	Render bool
+	// Output is one of OUTPUT_TEXT, OUTPUT_JSON or OUTPUT_NDJSON
+	Output string
+}
+
+type OutputError struct {
+	Kind    string `json:"kind"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+type OutputTiming struct {
+	StartedAt    time.Time `json:"started_at"`
+	FirstDeltaMs int64     `json:"first_delta_ms"`
+	DurationMs   int64     `json:"duration_ms"`
+}
+
+// OutputResult is printed with -output json and as the last -output ndjson
+// event.
+type OutputResult struct {
+	Completion
+	Error  *OutputError `json:"error,omitempty"`
+	Timing OutputTiming `json:"timing"`
+}
+
+type OutputEvent struct {
+	Type  string `json:"type"`
+	Delta string `json:"delta,omitempty"`
+	*OutputResult
+}
+
+// runPrompt asks a single question without the TUI. By default the raw reply
+// is streamed to out as it arrives, unless options.Render is set, in which case
+// the whole reply is rendered with glamour once it is complete.
+func runPrompt(ctx context.Context, provider Provider, prompt string, options PromptOptions, out io.Writer) error {
+	history := []HistoryMessage{
+		createSystemHistoryEntry(SYSTEM_PROMPT),
+		createHistoryEntry(prompt),
+	}
+
+	encoder := json.NewEncoder(out)
+	timing := OutputTiming{StartedAt: time.Now()}
+	written := 0
+
+	completion, err := provider.Send(ctx, history, func(reply string, done bool, isError bool) {
+		if done || len(reply) <= written {
+			return
+		}
+
+		if written == 0 {
+			timing.FirstDeltaMs = time.Since(timing.StartedAt).Milliseconds()
+		}
+
+		switch {
+		case options.Output == OUTPUT_NDJSON:
+			encoder.Encode(OutputEvent{Type: "delta", Delta: reply[written:]})
+		case options.Output == OUTPUT_TEXT && !options.Render:
+			fmt.Fprint(out, reply[written:])
+		}
+
+		written = len(reply)
+	})
+
+	timing.DurationMs = time.Since(timing.StartedAt).Milliseconds()
+
+	switch options.Output {
+	case OUTPUT_JSON:
+		encoder.Encode(newOutputResult(completion, err, timing))
+
+		return err
+
+	case OUTPUT_NDJSON:
+		event := OutputEvent{Type: "done", OutputResult: newOutputResult(completion, err, timing)}
+
+		if err != nil {
+			event.Type = "error"
+		}
+
+		encoder.Encode(event)
+
+		return err
+	}
+
+	if err != nil {
+		if written > 0 && !options.Render {
+			fmt.Fprintln(out)
+		}
+
+		return err
+	}
+
+	if options.Render {
+		fmt.Fprint(out, renderText(completion.Content, terminalWidth()))
+
+		return nil
+	}
+
+	fmt.Fprint(out, completion.Content[min(written, len(completion.Content)):])
+	fmt.Fprintln(out)
+
+	return nil
+}
+
+func newOutputResult(completion Completion, err error, timing OutputTiming) *OutputResult {
+	result := &OutputResult{Completion: completion, Timing: timing}
+
+	if err == nil {
+		return result
+	}
+
+	var providerError *ProviderError
+
+	if errors.As(err, &providerError) {
+		result.Error = &OutputError{
+			Kind:    providerError.Kind.String(),
+			Code:    providerError.Code,
+			Message: providerError.Error(),
+		}
+
+		return result
+	}
+
+	result.Error = &OutputError{Kind: ErrorAPI.String(), Message: err.Error()}
+
+	return result
+}
+
+func validOutput(output string) bool {
+	return output == OUTPUT_TEXT || output == OUTPUT_JSON || output == OUTPUT_NDJSON
+}
+
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+
+	if err != nil || width <= 0 {
+		return DEFAULT_RENDER_WIDTH
+	}
+
+	return width
+}
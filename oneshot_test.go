@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRunPrompt(t *testing.T) {
+	tests := []struct {
+		provider *FakeProvider
+		want     string
+		wantErr  bool
+	}{
+		{&FakeProvider{chunks: []string{"hello", " there"}, reply: "hello there"}, "hello there\n", false},
+		{&FakeProvider{reply: "not streamed"}, "not streamed\n", false},
+		{&FakeProvider{chunks: []string{"hel"}, err: errors.New("boom")}, "hel\n", true},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+
+		err := runPrompt(context.Background(), tt.provider, "question", PromptOptions{Output: OUTPUT_TEXT}, &out)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("got %v want error %t", err, tt.wantErr)
+		}
+
+		if out.String() != tt.want {
+			t.Errorf("got %q want %q", out.String(), tt.want)
+		}
+
+		history := tt.provider.history
+
+		if len(history) != 2 || history[0].Role != "system" || history[1].Content != "question" {
+			t.Errorf("got %v want system prompt and question", history)
+		}
+	}
+}
+
+func TestRunPromptRender(t *testing.T) {
+	var out bytes.Buffer
+
+	provider := &FakeProvider{chunks: []string{"# Title"}, reply: "# Title"}
+
+	err := runPrompt(context.Background(), provider, "question", PromptOptions{Render: true, Output: OUTPUT_TEXT}, &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "Title") || strings.Contains(out.String(), "# Title") {
+		t.Errorf("got %q want rendered markdown", out.String())
+	}
+}
+
+func TestRunPromptJSON(t *testing.T) {
+	var out bytes.Buffer
+
+	provider := &FakeProvider{chunks: []string{"hello", " there"}, reply: "hello there"}
+
+	err := runPrompt(context.Background(), provider, "question", PromptOptions{Output: OUTPUT_JSON}, &out)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result OutputResult
+
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Content != "hello there" || result.FinishReason != "stop" || result.Error != nil {
+		t.Errorf("got %+v want the completion", result)
+	}
+
+	if result.Timing.StartedAt.IsZero() {
+		t.Errorf("Missing timing")
+	}
+}
+
+func TestRunPromptNDJSON(t *testing.T) {
+	var out bytes.Buffer
+
+	err := newError(ErrorFiltered, "filtered", nil)
+	err.Code = "off_topic"
+	provider := &FakeProvider{chunks: []string{"hel", "lo"}, err: err}
+
+	got := runPrompt(context.Background(), provider, "question", PromptOptions{Output: OUTPUT_NDJSON}, &out)
+
+	if got == nil {
+		t.Errorf("Expected an error")
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+
+	if len(lines) != 3 {
+		t.Fatalf("got %d want %d events: %s", len(lines), 3, out.String())
+	}
+
+	want := []string{"delta", "delta", "error"}
+
+	for i, line := range lines {
+		var event struct {
+			Type  string       `json:"type"`
+			Delta string       `json:"delta"`
+			Error *OutputError `json:"error"`
+		}
+
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+
+		if event.Type != want[i] {
+			t.Errorf("got %s want %s", event.Type, want[i])
+		}
+
+		if i == 1 && event.Delta != "lo" {
+			t.Errorf("got %s want %s", event.Delta, "lo")
+		}
+
+		if i == 2 && (event.Error == nil || event.Error.Code != "off_topic" || event.Error.Kind != "response filtered") {
+			t.Errorf("got %+v want the filtered error", event.Error)
+		}
+	}
+}
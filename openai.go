@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const OPENAI_DEFAULT_BASE_URL = "https://api.openai.com/v1"
+
+// OpenAIProvider talks to any endpoint implementing the OpenAI
+// chat/completions API, such as vLLM, LiteLLM or Azure-style proxies.
+type OpenAIProvider struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Params  GenerationParams
+}
+
+func (p *OpenAIProvider) SetParams(params GenerationParams) {
+	p.Params = params
+}
+
+func (p *OpenAIProvider) Send(ctx context.Context, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error) {
+	request, _ := generateAskRequest(history, ModelInfo{ID: p.Model}, p.Params)
+	request.Intent = false
+	// The output limit of the served model is unknown, the server one is used
+	// unless the user set one
+	request.Maxtokens = p.Params.MaxTokens
+
+	body, err := json.Marshal(request)
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	url := strings.TrimRight(p.BaseURL, "/") + "/chat/completions"
+
+	log.Println("Sending request to:", url)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+
+	if err != nil {
+		return Completion{}, err
+	}
+
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set("accept", "text/event-stream")
+
+	if p.APIKey != "" {
+		req.Header.Set("authorization", "Bearer "+p.APIKey)
+	}
+
+	return streamResponse(req, callback)
+}
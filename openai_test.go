@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIProviderSend(t *testing.T) {
+	var got Request
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("got %s want %s", r.URL.Path, "/v1/chat/completions")
+		}
+
+		if r.Header.Get("authorization") != "Bearer secret" {
+			t.Errorf("got %s want %s", r.Header.Get("authorization"), "Bearer secret")
+		}
+
+		body, _ = io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\" there\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+
+	defer server.Close()
+
+	provider := &OpenAIProvider{BaseURL: server.URL + "/v1/", APIKey: "secret", Model: "llama3"}
+
+	reply, err := provider.Send(context.Background(), []HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reply.Content != "hello there" {
+		t.Errorf("got %s want %s", reply.Content, "hello there")
+	}
+
+	if got.Model != "llama3" {
+		t.Errorf("got %s want %s", got.Model, "llama3")
+	}
+
+	if len(got.Messages) != 2 {
+		t.Errorf("got %d want %d", len(got.Messages), 2)
+	}
+
+	if strings.Contains(string(body), "max_tokens") {
+		t.Errorf("got %s want no max_tokens", body)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	t.Setenv("OPENAI_MODEL", "")
+	t.Setenv("OLLAMA_MODEL", "")
+
+	tests := []struct {
+		config  ProviderConfig
+		wantErr bool
+	}{
+		{ProviderConfig{Name: "openai", Model: "gpt-4o"}, false},
+		{ProviderConfig{Name: "openai"}, true},
+		{ProviderConfig{Name: "ollama", Model: "llama3"}, false},
+		{ProviderConfig{Name: "ollama"}, true},
+		{ProviderConfig{Name: "unknown"}, true},
+	}
+
+	for _, tt := range tests {
+		_, err := newProvider(tt.config)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("got %v want error %t", err, tt.wantErr)
+		}
+	}
+}
+
+func TestNewProviderConfigModel(t *testing.T) {
+	t.Setenv("OPENAI_MODEL", "")
+	t.Setenv("OLLAMA_MODEL", "")
+
+	previous := appConfig
+
+	t.Cleanup(func() { appConfig = previous })
+
+	appConfig.Provider = "ollama"
+	appConfig.Model = "llama3"
+
+	tests := []struct {
+		config ProviderConfig
+		env    string
+		want   string
+	}{
+		{ProviderConfig{Name: "ollama"}, "", "llama3"},
+		// The flag and then the environment take precedence over the file
+		{ProviderConfig{Name: "ollama", Model: "qwen2"}, "mistral", "qwen2"},
+		{ProviderConfig{Name: "ollama"}, "mistral", "mistral"},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("OLLAMA_MODEL", tt.env)
+
+		provider, err := newProvider(tt.config)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := provider.(*OllamaProvider).Model; got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+
+	// The model of another provider is not used
+	if _, err := newProvider(ProviderConfig{Name: "openai"}); err == nil {
+		t.Errorf("got nil want an error")
+	}
+}
+
+func TestOpenAIProviderCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n")
+
+		w.(http.Flusher).Flush()
+
+		<-r.Context().Done()
+	}))
+
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &OpenAIProvider{BaseURL: server.URL, Model: "llama3"}
+
+	reply, err := provider.Send(ctx, []HistoryMessage{createHistoryEntry("hi")}, func(reply string, done bool, isError bool) {
+		if !done {
+			cancel()
+		}
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v want %v", err, context.Canceled)
+	}
+
+	if reply.Content != "hello" {
+		t.Errorf("got %s want %s", reply.Content, "hello")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const MAX_CHOICES = 4
+
+// GenerationParams are the sampling parameters of a conversation. A zero
+// MaxTokens uses the output limit of the model.
+type GenerationParams struct {
+	Temperature float32 `json:"temperature"`
+	TopP        float32 `json:"top_p"`
+	MaxTokens   int     `json:"max_tokens"`
+	N           int     `json:"n"`
+}
+
+var DefaultGenerationParams = GenerationParams{
+	Temperature: 0.1,
+	TopP:        1,
+	N:           1,
+}
+
+// orDefault returns the defaults for params that were never set, such as the
+// ones of sessions saved before they existed.
+func (p GenerationParams) orDefault() GenerationParams {
+	if p == (GenerationParams{}) {
+		return DefaultGenerationParams
+	}
+
+	return p
+}
+
+// validate checks the ranges the APIs accept. maxOutput is the output limit
+// of the model, zero if unknown.
+func (p GenerationParams) validate(maxOutput int) error {
+	switch {
+	case p.Temperature < 0 || p.Temperature > 2:
+		return fmt.Errorf("temperature must be between 0 and 2")
+	case p.TopP <= 0 || p.TopP > 1:
+		return fmt.Errorf("top_p must be greater than 0 and at most 1")
+	case p.MaxTokens < 0:
+		return fmt.Errorf("max_tokens cannot be negative, use 0 for the model limit")
+	case maxOutput > 0 && p.MaxTokens > maxOutput:
+		return fmt.Errorf("max_tokens cannot exceed the model limit of %d", maxOutput)
+	case p.N < 1 || p.N > MAX_CHOICES:
+		return fmt.Errorf("n must be between 1 and %d", MAX_CHOICES)
+	}
+
+	return nil
+}
+
+// clamp brings params that were not checked by validate, like the ones of a
+// saved session or of another model, into the accepted ranges. The changes
+// are described for the user, there are none when the params are valid.
+func (p GenerationParams) clamp(maxOutput int) (GenerationParams, string) {
+	var changes []string
+
+	if p.Temperature < 0 || p.Temperature > 2 {
+		p.Temperature = min(max(p.Temperature, 0), 2)
+		changes = append(changes, fmt.Sprintf("temperature to %s", formatFloat(p.Temperature)))
+	}
+
+	if p.TopP <= 0 || p.TopP > 1 {
+		p.TopP = 1
+		changes = append(changes, "top_p to 1")
+	}
+
+	if p.MaxTokens < 0 {
+		p.MaxTokens = 0
+		changes = append(changes, "max_tokens to the model limit")
+	}
+
+	if maxOutput > 0 && p.MaxTokens > maxOutput {
+		p.MaxTokens = maxOutput
+		changes = append(changes, fmt.Sprintf("max_tokens to the model limit of %d", maxOutput))
+	}
+
+	if p.N < 1 || p.N > MAX_CHOICES {
+		p.N = min(max(p.N, 1), MAX_CHOICES)
+		changes = append(changes, fmt.Sprintf("n to %d", p.N))
+	}
+
+	if len(changes) == 0 {
+		return p, ""
+	}
+
+	return p, "The generation settings were out of range, changed " + strings.Join(changes, ", ")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestGenerationParamsValidate(t *testing.T) {
+	tests := []struct {
+		params    GenerationParams
+		maxOutput int
+		wantErr   bool
+	}{
+		{DefaultGenerationParams, 0, false},
+		{GenerationParams{Temperature: 2, TopP: 0.1, MaxTokens: 4096, N: MAX_CHOICES}, 4096, false},
+		{GenerationParams{Temperature: 2.5, TopP: 1, N: 1}, 0, true},
+		{GenerationParams{Temperature: -0.1, TopP: 1, N: 1}, 0, true},
+		{GenerationParams{Temperature: 1, TopP: 0, N: 1}, 0, true},
+		{GenerationParams{Temperature: 1, TopP: 1.1, N: 1}, 0, true},
+		{GenerationParams{Temperature: 1, TopP: 1, MaxTokens: -1, N: 1}, 0, true},
+		{GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 5000, N: 1}, 4096, true},
+		{GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 5000, N: 1}, 0, false},
+		{GenerationParams{Temperature: 1, TopP: 1, N: 0}, 0, true},
+		{GenerationParams{Temperature: 1, TopP: 1, N: MAX_CHOICES + 1}, 0, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.params.validate(tt.maxOutput)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v: got %v want error %t", tt.params, err, tt.wantErr)
+		}
+	}
+}
+
+func TestGenerationParamsClamp(t *testing.T) {
+	tests := []struct {
+		params      GenerationParams
+		maxOutput   int
+		want        GenerationParams
+		wantChanges bool
+	}{
+		{DefaultGenerationParams, 4096, DefaultGenerationParams, false},
+		{GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 8192, N: 1}, 4096, GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 4096, N: 1}, true},
+		{GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 8192, N: 1}, 0, GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 8192, N: 1}, false},
+		{GenerationParams{Temperature: 3, TopP: 0, MaxTokens: -1, N: 9}, 0, GenerationParams{Temperature: 2, TopP: 1, MaxTokens: 0, N: MAX_CHOICES}, true},
+	}
+
+	for _, tt := range tests {
+		got, changes := tt.params.clamp(tt.maxOutput)
+
+		if got != tt.want || (changes != "") != tt.wantChanges {
+			t.Errorf("got %+v %q want %+v", got, changes, tt.want)
+		}
+
+		if err := got.validate(tt.maxOutput); err != nil {
+			t.Errorf("%+v: %v", got, err)
+		}
+	}
+}
+
+func TestModelSwitchParams(t *testing.T) {
+	switcher := &FakeSwitcher{
+		model:  ModelInfo{ID: "gpt-4o", MaxOutput: 16384},
+		models: []ModelInfo{{ID: "gpt-4o", MaxOutput: 16384}, {ID: "gpt-4", MaxOutput: 4096}},
+	}
+
+	m := initialModel(switcher)
+	m.session.Params = GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 10000, N: 1}
+
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	m = updated.(model)
+
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlG})
+	m = updated.(model)
+
+	for _, msg := range cmdMessages(cmd) {
+		updated, _ = m.Update(msg)
+		m = updated.(model)
+	}
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = updated.(model)
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	if m.session.Params.MaxTokens != 4096 {
+		t.Errorf("got %d want %d", m.session.Params.MaxTokens, 4096)
+	}
+
+	if last := m.messages[len(m.messages)-1]; last.Role != "error" || !strings.Contains(last.Content, "max_tokens") {
+		t.Errorf("got %+v want the change to be shown", last)
+	}
+
+	// The params of a resumed session are clamped before they are sent
+	m = m.resumeSession(Session{ID: "old", Params: GenerationParams{Temperature: 1, TopP: 1, MaxTokens: 10000, N: 1}})
+
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	if switcher.params.MaxTokens != 4096 {
+		t.Errorf("got %d want %d", switcher.params.MaxTokens, 4096)
+	}
+}
+
+func TestSettings(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	provider := &FakeProvider{reply: "hello"}
+	m := initialModel(provider)
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlS})
+	m = updated.(model)
+
+	if !m.editingSettings {
+		t.Fatalf("The settings are not open")
+	}
+
+	// Replace the temperature with an out of range value
+	m.settings.inputs[temperatureField].SetValue("3")
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	if !m.editingSettings || m.settings.err == nil {
+		t.Fatalf("got %v want a validation error", m.settings.err)
+	}
+
+	m.settings.inputs[temperatureField].SetValue("0.7")
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	m = updated.(model)
+
+	if m.settings.focus != topPField {
+		t.Errorf("got %d want %d", m.settings.focus, topPField)
+	}
+
+	m.settings.inputs[nField].SetValue("2")
+
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(model)
+
+	want := GenerationParams{Temperature: 0.7, TopP: 1, MaxTokens: 0, N: 2}
+
+	if m.editingSettings || m.session.Params != want {
+		t.Errorf("got %+v want %+v", m.session.Params, want)
+	}
+
+	// The params are given to the provider before asking
+	updated, _ = m.Update(ResponseMsg{})
+	m = updated.(model)
+
+	if provider.params != want {
+		t.Errorf("got %+v want %+v", provider.params, want)
+	}
+
+	// A cleared conversation keeps them
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlL})
+	m = updated.(model)
+
+	if m.session.Params != want {
+		t.Errorf("got %+v want %+v", m.session.Params, want)
+	}
+}
+
+func TestResumeSessionParams(t *testing.T) {
+	m := initialModel(&FakeProvider{})
+
+	// Sessions saved before the params existed
+	m = m.resumeSession(Session{ID: "old"})
+
+	if m.session.Params != DefaultGenerationParams {
+		t.Errorf("got %+v want %+v", m.session.Params, DefaultGenerationParams)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type modelItem struct {
+	model   ModelInfo
+	current bool
+}
+
+func (i modelItem) Title() string {
+	title := firstNonEmpty(i.model.Name, i.model.ID)
+
+	if i.current {
+		title += " (current)"
+	}
+
+	return title
+}
+
+func (i modelItem) Description() string { return describeModel(i.model) }
+func (i modelItem) FilterValue() string { return i.model.ID + " " + i.model.Name }
+
+// describeModel summarizes the limits and capabilities of a model.
+func describeModel(model ModelInfo) string {
+	parts := []string{model.ID}
+
+	if model.ContextWindow > 0 {
+		parts = append(parts, formatTokens(model.ContextWindow)+" context")
+	}
+
+	if model.MaxOutput > 0 {
+		parts = append(parts, formatTokens(model.MaxOutput)+" output")
+	}
+
+	if model.ToolCalls {
+		parts = append(parts, "tools")
+	}
+
+	if model.Vision {
+		parts = append(parts, "vision")
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+type ModelsMsg struct {
+	models []ModelInfo
+}
+
+// listModels fetches the models in the background, the picker is opened once
+// they arrive.
+func listModels(switcher ModelSwitcher) tea.Cmd {
+	return func() tea.Msg {
+		models, err := switcher.Models(context.Background())
+
+		if err != nil {
+			return ErrorMsg{err: err}
+		}
+
+		return ModelsMsg{models: models}
+	}
+}
+
+func newModelPicker(models []ModelInfo, current string, width int, height int) list.Model {
+	items := make([]list.Item, len(models))
+	selected := 0
+
+	for i, model := range models {
+		items[i] = modelItem{model: model, current: model.ID == current}
+
+		if model.ID == current {
+			selected = i
+		}
+	}
+
+	picker := list.New(items, list.NewDefaultDelegate(), width, height)
+	picker.Title = "Models"
+	picker.SetStatusBarItemName("model", "models")
+	picker.DisableQuitKeybindings()
+	picker.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{browserKeys.Open, browserKeys.Close}
+	}
+	picker.Select(selected)
+
+	return picker
+}
+
+// updatePicker handles the messages while the model picker is open.
+func (m model) updatePicker(msg tea.Msg) (model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	keyMsg, isKey := msg.(tea.KeyMsg)
+
+	if isKey && key.Matches(keyMsg, m.keys.Quit) {
+		return m, tea.Quit
+	}
+
+	if isKey && m.picker.FilterState() != list.Filtering {
+		switch {
+		case key.Matches(keyMsg, browserKeys.Close):
+			if m.picker.FilterState() == list.FilterApplied {
+				m.picker.ResetFilter()
+
+				return m, nil
+			}
+
+			m.picking = false
+
+			return m, nil
+
+		case key.Matches(keyMsg, browserKeys.Open):
+			item, ok := m.picker.SelectedItem().(modelItem)
+			switcher, isSwitcher := m.provider.(ModelSwitcher)
+
+			if !ok || !isSwitcher {
+				return m, nil
+			}
+
+			m.picking = false
+
+			if err := switcher.SetModel(item.model.ID); err != nil {
+				return m, func() tea.Msg { return ErrorMsg{err: err} }
+			}
+
+			// The max tokens may not fit the new model
+			return m.fitParams(), nil
+		}
+	}
+
+	m.picker, cmd = m.picker.Update(msg)
+
+	return m, cmd
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Provider is a chat backend. It receives the whole conversation history,
+// streams the partial reply through callback(reply, done, isError) and returns
+// the final completion once the stream is over. When ctx is cancelled
+// mid-stream the partial completion is returned together with ctx.Err().
+type Provider interface {
+	Send(ctx context.Context, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error)
+}
+
+// Completion is the final result of a request. FinishReason and
+// ContentFilterResults are only set when the backend reports them.
+type Completion struct {
+	Content              string                `json:"content"`
+	FinishReason         string                `json:"finish_reason,omitempty"`
+	ContentFilterResults *ContentFilterResults `json:"content_filter_results,omitempty"`
+}
+
+// Reloader is implemented by providers that hold credentials that can be
+// refreshed on demand.
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// ModelInfo describes a model and its limits, a zero limit is unknown.
+type ModelInfo struct {
+	ID            string `json:"id"`
+	Name          string `json:"name,omitempty"`
+	Vendor        string `json:"vendor,omitempty"`
+	Tokenizer     string `json:"tokenizer,omitempty"`
+	ContextWindow int    `json:"context_window,omitempty"`
+	MaxPrompt     int    `json:"max_prompt,omitempty"`
+	MaxOutput     int    `json:"max_output,omitempty"`
+	Streaming     bool   `json:"streaming,omitempty"`
+	ToolCalls     bool   `json:"tool_calls,omitempty"`
+	Vision        bool   `json:"vision,omitempty"`
+}
+
+// ModelSwitcher is implemented by providers that can list their models and
+// change the one used by the next requests.
+type ModelSwitcher interface {
+	Models(ctx context.Context) ([]ModelInfo, error)
+	Model() ModelInfo
+	SetModel(id string) error
+}
+
+// Tunable is implemented by providers whose generation parameters can be
+// changed, they apply to the next requests.
+type Tunable interface {
+	SetParams(params GenerationParams)
+}
+
+// SessionResetter is implemented by providers that send a session ID, a new
+// one is started for every conversation.
+type SessionResetter interface {
+	ResetSession()
+}
+
+// providerNames are the chat backends newProvider knows.
+var providerNames = []string{"copilot", "openai", "ollama"}
+
+type ProviderConfig struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	Model   string
+	// Account picks the GitHub account of the copilot provider
+	Account string
+}
+
+func newProvider(config ProviderConfig) (Provider, error) {
+	switch config.Name {
+	case "", "copilot":
+		provider, err := newAccountProvider(firstNonEmpty(config.Account, os.Getenv("COPILOT_ACCOUNT")))
+
+		if err != nil {
+			return nil, err
+		}
+
+		model := firstNonEmpty(config.Model, os.Getenv("COPILOT_MODEL"), appConfig.modelFor("copilot"))
+
+		if model != "" {
+			if err := provider.SetModel(model); err != nil {
+				return nil, err
+			}
+		}
+
+		return provider, nil
+
+	case "openai":
+		baseURL := firstNonEmpty(config.BaseURL, os.Getenv("OPENAI_BASE_URL"), OPENAI_DEFAULT_BASE_URL)
+		apiKey := firstNonEmpty(config.APIKey, os.Getenv("OPENAI_API_KEY"))
+		model := firstNonEmpty(config.Model, os.Getenv("OPENAI_MODEL"), appConfig.modelFor("openai"))
+
+		if model == "" {
+			return nil, fmt.Errorf("the openai provider requires a model")
+		}
+
+		return &OpenAIProvider{BaseURL: baseURL, APIKey: apiKey, Model: model}, nil
+
+	case "ollama":
+		baseURL := firstNonEmpty(config.BaseURL, os.Getenv("OLLAMA_HOST"), OLLAMA_DEFAULT_BASE_URL)
+		model := firstNonEmpty(config.Model, os.Getenv("OLLAMA_MODEL"), appConfig.modelFor("ollama"))
+
+		if model == "" {
+			return nil, fmt.Errorf("the ollama provider requires a model")
+		}
+
+		if !strings.Contains(baseURL, "://") {
+			baseURL = "http://" + baseURL
+		}
+
+		return &OllamaProvider{BaseURL: baseURL, Model: model}, nil
+	}
+
+	return nil, fmt.Errorf("unknown provider %q", config.Name)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const REDACTED = "[REDACTED]"
+
+// httpTransport is used by every API client so the traffic can be recorded.
+var httpTransport http.RoundTripper = http.DefaultTransport
+
+// Recording is one request/response exchange, stored as a JSONL line.
+type Recording struct {
+	Time            time.Time   `json:"time"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	Headers         http.Header `json:"headers"`
+	Body            string      `json:"body,omitempty"`
+	Status          int         `json:"status"`
+	ResponseHeaders http.Header `json:"response_headers"`
+	Lines           []string    `json:"lines"`
+}
+
+// Recorder is a http.RoundTripper that writes every exchange to a JSONL file.
+// The credentials are redacted before writing.
+type Recorder struct {
+	mu        sync.Mutex
+	encoder   *json.Encoder
+	transport http.RoundTripper
+}
+
+func NewRecorder(w io.Writer, transport http.RoundTripper) *Recorder {
+	return &Recorder{encoder: json.NewEncoder(w), transport: transport}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recording := Recording{
+		Time:    time.Now(),
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: redactHeaders(req.Header),
+	}
+
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+
+		req.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		recording.Body = string(body)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	recording.Status = resp.StatusCode
+	recording.ResponseHeaders = resp.Header.Clone()
+
+	resp.Body = &recordingBody{ReadCloser: resp.Body, recorder: r, recording: recording}
+
+	return resp, nil
+}
+
+func (r *Recorder) write(recording Recording) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.encoder.Encode(recording)
+}
+
+// recordingBody keeps a copy of the response and writes the recording once
+// the body is closed.
+type recordingBody struct {
+	io.ReadCloser
+	recorder  *Recorder
+	recording Recording
+	buffer    bytes.Buffer
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	b.buffer.Write(p[:n])
+
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		content := strings.TrimSuffix(b.buffer.String(), "\n")
+
+		if content != "" {
+			for _, line := range strings.Split(content, "\n") {
+				b.recording.Lines = append(b.recording.Lines, redactToken(line))
+			}
+		}
+
+		b.recorder.write(b.recording)
+	})
+
+	return b.ReadCloser.Close()
+}
+
+// identifyingHeaders tie a recording to a machine or a session, they are
+// redacted so the recording can be shared.
+var identifyingHeaders = []string{"vscode-machineid", "vscode-sessionid"}
+
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+
+	for _, name := range identifyingHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, REDACTED)
+		}
+	}
+
+	if value := redacted.Get("authorization"); value != "" {
+		scheme, _, _ := strings.Cut(value, " ")
+
+		redacted.Set("authorization", scheme+" "+REDACTED)
+	}
+
+	return redacted
+}
+
+// redactToken hides the Copilot token returned by the token API.
+func redactToken(line string) string {
+	var response map[string]interface{}
+
+	if json.Unmarshal([]byte(line), &response) != nil {
+		return line
+	}
+
+	if _, ok := response["token"]; !ok {
+		return line
+	}
+
+	response["token"] = REDACTED
+
+	redacted, _ := json.Marshal(response)
+
+	return string(redacted)
+}
+
+func loadRecordings(path string) ([]Recording, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var recordings []Recording
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var recording Recording
+
+		if err := json.Unmarshal(scanner.Bytes(), &recording); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		recordings = append(recordings, recording)
+	}
+
+	return recordings, scanner.Err()
+}
+
+// ReplayProvider answers with the chat completions of a recording, in order,
+// without touching the network.
+type ReplayProvider struct {
+	mu         sync.Mutex
+	recordings []Recording
+}
+
+func NewReplayProvider(path string) (*ReplayProvider, error) {
+	recordings, err := loadRecordings(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	p := &ReplayProvider{}
+
+	// Only the chat completions are replayed, the token requests are skipped
+	for _, recording := range recordings {
+		if isChatRecording(recording) {
+			p.recordings = append(p.recordings, recording)
+		}
+	}
+
+	if len(p.recordings) == 0 {
+		return nil, fmt.Errorf("%s has no recorded chat completions", path)
+	}
+
+	return p, nil
+}
+
+func isChatRecording(recording Recording) bool {
+	return strings.HasSuffix(recording.URL, "/chat/completions") || strings.HasSuffix(recording.URL, "/api/chat")
+}
+
+func (p *ReplayProvider) Send(ctx context.Context, history []HistoryMessage, callback func(string, bool, bool)) (Completion, error) {
+	p.mu.Lock()
+
+	if len(p.recordings) == 0 {
+		p.mu.Unlock()
+
+		return Completion{}, errors.New("there are no more recorded answers to replay")
+	}
+
+	recording := p.recordings[0]
+	p.recordings = p.recordings[1:]
+
+	p.mu.Unlock()
+
+	body := io.NopCloser(strings.NewReader(strings.Join(recording.Lines, "\n") + "\n"))
+
+	if strings.HasSuffix(recording.URL, "/api/chat") {
+		return parseOllamaResponse(ctx, body, callback)
+	}
+
+	return parseResponse(ctx, body, callback)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.Chunks = []string{"hello", " recorded"}
+
+	var buffer bytes.Buffer
+
+	httpTransport = NewRecorder(&buffer, http.DefaultTransport)
+	t.Cleanup(func() { httpTransport = http.DefaultTransport })
+
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recordings []Recording
+
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		var recording Recording
+
+		if err := json.Unmarshal([]byte(line), &recording); err != nil {
+			t.Fatal(err)
+		}
+
+		recordings = append(recordings, recording)
+	}
+
+	// The token, the models listing and the completion
+	if len(recordings) != 3 {
+		t.Fatalf("got %d want %d recordings", len(recordings), 3)
+	}
+
+	token, completion := recordings[0], recordings[2]
+
+	if token.Headers.Get("authorization") != "token "+REDACTED || strings.Contains(buffer.String(), FAKE_OAUTH_TOKEN) {
+		t.Errorf("got %s want the OAuth token redacted", token.Headers.Get("authorization"))
+	}
+
+	if len(token.Lines) != 1 || !strings.Contains(token.Lines[0], `"token":"`+REDACTED+`"`) || strings.Contains(buffer.String(), "tid=") {
+		t.Errorf("got %v want the Copilot token redacted", token.Lines)
+	}
+
+	if completion.Headers.Get("authorization") != "Bearer "+REDACTED {
+		t.Errorf("got %s want %s", completion.Headers.Get("authorization"), "Bearer "+REDACTED)
+	}
+
+	for _, name := range []string{"vscode-machineid", "vscode-sessionid"} {
+		if completion.Headers.Get(name) != REDACTED {
+			t.Errorf("got %s=%s want %s", name, completion.Headers.Get(name), REDACTED)
+		}
+	}
+
+	if completion.Status != http.StatusOK || !strings.Contains(completion.Body, `"content":"hi"`) {
+		t.Errorf("got %d %s want the request body", completion.Status, completion.Body)
+	}
+
+	// The recording is replayed as the same answer
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	if err := os.WriteFile(path, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := NewReplayProvider(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := replay.Send(context.Background(), nil, func(string, bool, bool) {})
+
+	if err != nil || got.Content != "hello recorded" {
+		t.Errorf("got %s %v want %s", got.Content, err, "hello recorded")
+	}
+}
+
+func TestReplayProvider(t *testing.T) {
+	provider, err := NewReplayProvider(filepath.Join("testdata", "copilot_session.jsonl"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deltas := 0
+
+	got, err := provider.Send(context.Background(), nil, func(reply string, done bool, isError bool) {
+		if !done {
+			deltas++
+		}
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Content != "Hello, how can I help?" || got.FinishReason != "stop" || deltas != 2 {
+		t.Errorf("got %+v with %d deltas want %s", got, deltas, "Hello, how can I help?")
+	}
+
+	_, err = provider.Send(context.Background(), nil, func(string, bool, bool) {})
+
+	if !errors.Is(err, &ProviderError{Kind: ErrorFiltered}) {
+		t.Errorf("got %v want %s", err, ErrorFiltered)
+	}
+
+	_, err = provider.Send(context.Background(), nil, func(string, bool, bool) {})
+
+	if err == nil {
+		t.Errorf("got nil want an error once the recordings are exhausted")
+	}
+}
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{"expires_at":1,"token":"tid=1;exp=1"}`, `{"expires_at":1,"token":"[REDACTED]"}`},
+		{`data: {"choices":[]}`, `data: {"choices":[]}`},
+		{`{"message":"Bad credentials"}`, `{"message":"Bad credentials"}`},
+	}
+
+	for _, tt := range tests {
+		got := redactToken(tt.input)
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
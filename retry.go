@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how transient failures are retried.
+type RetryPolicy struct {
+	Attempts  int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var retryPolicy = RetryPolicy{
+	Attempts:  3,
+	BaseDelay: 500 * time.Millisecond,
+	MaxDelay:  30 * time.Second,
+}
+
+type retryHookKey struct{}
+
+// WithRetryHook returns a context that calls hook before every new attempt,
+// so the UI can tell the user the request is being retried.
+func WithRetryHook(ctx context.Context, hook func(attempt int, attempts int)) context.Context {
+	return context.WithValue(ctx, retryHookKey{}, hook)
+}
+
+// permanentError stops the retries even if the wrapped error is transient.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// retry calls attempt until it succeeds, fails with an error that is not
+// transient or runs out of attempts.
+func retry(ctx context.Context, attempt func() error) error {
+	for i := 1; ; i++ {
+		err := attempt()
+
+		var permanent permanentError
+
+		if errors.As(err, &permanent) {
+			return permanent.error
+		}
+
+		if err == nil || !isTransient(err) || i >= retryPolicy.Attempts {
+			return err
+		}
+
+		delay, ok := retryDelay(i, err)
+
+		if !ok {
+			return err
+		}
+
+		log.Printf("Retrying in %s after: %v", delay, err)
+
+		if hook, ok := ctx.Value(retryHookKey{}).(func(int, int)); ok {
+			hook(i+1, retryPolicy.Attempts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isTransient tells whether the request may succeed if sent again.
+func isTransient(err error) bool {
+	var providerError *ProviderError
+
+	if !errors.As(err, &providerError) {
+		return false
+	}
+
+	return providerError.Kind == ErrorNetwork ||
+		providerError.Kind == ErrorRateLimited ||
+		providerError.Status >= http.StatusInternalServerError
+}
+
+// retryDelay waits what the server asked for in Retry-After, or backs off
+// exponentially with jitter. It returns false when the server asks to wait
+// longer than the policy allows.
+func retryDelay(attempt int, err error) (time.Duration, bool) {
+	var providerError *ProviderError
+
+	if errors.As(err, &providerError) && providerError.RetryAfter > 0 {
+		return providerError.RetryAfter, providerError.RetryAfter <= retryPolicy.MaxDelay
+	}
+
+	delay := retryPolicy.BaseDelay << (attempt - 1)
+
+	if delay > retryPolicy.MaxDelay || delay <= 0 {
+		delay = retryPolicy.MaxDelay
+	}
+
+	// Half of the delay is random so the clients do not retry all at once
+	return delay/2 + rand.N(delay/2+1), true
+}
+
+// parseRetryAfter reads a Retry-After header, given either in seconds or as
+// a HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return 0
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Keep the tests fast, the policy itself is checked by TestRetryDelay
+func init() {
+	retryPolicy.BaseDelay = time.Millisecond
+}
+
+func TestRetry(t *testing.T) {
+	transient := newError(ErrorNetwork, "offline", nil)
+
+	tests := []struct {
+		name     string
+		errs     []error
+		want     error
+		attempts int
+	}{
+		{"success", []error{nil}, nil, 1},
+		{"transient then success", []error{transient, transient, nil}, nil, 3},
+		{"exhausted", []error{transient, transient, transient, nil}, transient, 3},
+		{"not transient", []error{newError(ErrorAuthFailed, "denied", nil), nil}, &ProviderError{Kind: ErrorAuthFailed}, 1},
+		{"server error", []error{&ProviderError{Kind: ErrorAPI, Status: http.StatusBadGateway}, nil}, nil, 2},
+		{"permanent", []error{permanentError{transient}, nil}, transient, 1},
+	}
+
+	for _, tt := range tests {
+		attempts := 0
+		hooks := []string{}
+
+		ctx := WithRetryHook(context.Background(), func(attempt int, total int) {
+			hooks = append(hooks, fmt.Sprintf("%d/%d", attempt, total))
+		})
+
+		err := retry(ctx, func() error {
+			attempts++
+
+			return tt.errs[attempts-1]
+		})
+
+		if !errors.Is(err, tt.want) && err != tt.want {
+			t.Errorf("%s: got %v want %v", tt.name, err, tt.want)
+		}
+
+		if attempts != tt.attempts || len(hooks) != tt.attempts-1 {
+			t.Errorf("%s: got %d attempts and hooks %v want %d attempts", tt.name, attempts, hooks, tt.attempts)
+		}
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+
+	err := retry(ctx, func() error {
+		attempts++
+
+		cancel()
+
+		return newError(ErrorNetwork, "offline", nil)
+	})
+
+	if !errors.Is(err, context.Canceled) || attempts != 1 {
+		t.Errorf("got %v after %d attempts want %v", err, attempts, context.Canceled)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := retryPolicy
+
+	retryPolicy = RetryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+	t.Cleanup(func() { retryPolicy = policy })
+
+	for attempt, limit := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		delay, ok := retryDelay(attempt+1, newError(ErrorNetwork, "offline", nil))
+
+		if !ok || delay < limit/2 || delay > limit {
+			t.Errorf("got %s want a delay between %s and %s", delay, limit/2, limit)
+		}
+	}
+
+	delay, ok := retryDelay(1, &ProviderError{Kind: ErrorRateLimited, RetryAfter: 7 * time.Second})
+
+	if !ok || delay != 7*time.Second {
+		t.Errorf("got %s want %s", delay, 7*time.Second)
+	}
+
+	_, ok = retryDelay(1, &ProviderError{Kind: ErrorRateLimited, RetryAfter: time.Hour})
+
+	if ok {
+		t.Errorf("got a retry want none when asked to wait longer than %s", retryPolicy.MaxDelay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+	}
+
+	for _, tt := range tests {
+		got := parseRetryAfter(tt.input)
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+
+	if got := parseRetryAfter(date); got < 58*time.Second || got > time.Minute {
+		t.Errorf("got %s want about a minute", got)
+	}
+}
+
+func TestCopilotProviderRetry(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.Failures = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	fake.RetryAfter = "0"
+
+	provider := NewCopilotProvider(fake.Endpoints())
+	hooks := []string{}
+	done := 0
+
+	ctx := WithRetryHook(context.Background(), func(attempt int, total int) {
+		hooks = append(hooks, fmt.Sprintf("%d/%d", attempt, total))
+	})
+
+	got, err := provider.Send(ctx, []HistoryMessage{createHistoryEntry("hi")}, func(reply string, last bool, isError bool) {
+		if last {
+			done++
+		}
+	})
+
+	if err != nil || got.Content != "hello" {
+		t.Fatalf("got %s %v want %s", got.Content, err, "hello")
+	}
+
+	if len(fake.CompletionBodies) != 3 || fmt.Sprint(hooks) != "[2/3 3/3]" {
+		t.Errorf("got %d requests and hooks %v want 3 requests", len(fake.CompletionBodies), hooks)
+	}
+
+	if done != 1 {
+		t.Errorf("got %d final callbacks want %d", done, 1)
+	}
+}
+
+func TestStreamResponseNoRetryAfterDelta(t *testing.T) {
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hello\"}}]}\n\n")
+
+		w.(http.Flusher).Flush()
+
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer server.Close()
+
+	provider := &OpenAIProvider{BaseURL: server.URL, Model: "llama3"}
+
+	got, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if !errors.Is(err, &ProviderError{Kind: ErrorNetwork}) || got.Content != "hello" {
+		t.Errorf("got %s %v want the partial answer and a network error", got.Content, err)
+	}
+
+	if requests != 1 {
+		t.Errorf("got %d requests want %d", requests, 1)
+	}
+}
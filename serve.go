@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+const DEFAULT_SERVE_ADDRESS = "127.0.0.1:8080"
+
+type ModelObject struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelList struct {
+	Object string        `json:"object"`
+	Data   []ModelObject `json:"data"`
+}
+
+// Server exposes an OpenAI-compatible API that forwards every request to
+// Copilot, so other tools do not need to deal with the hosts.json token.
+type Server struct {
+	provider *CopilotProvider
+}
+
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	config := configFlag(flags)
+	address := flags.String("addr", DEFAULT_SERVE_ADDRESS, "Address to listen on")
+	model := flags.String("model", "", "Model used when the request does not set one")
+	account := flags.String("account", os.Getenv("COPILOT_ACCOUNT"), "GitHub account, a user, a host or user@host")
+
+	flags.Parse(args)
+
+	if err := useConfig(*config); err != nil {
+		return err
+	}
+
+	provider, err := newAccountProvider(*account)
+
+	if err != nil {
+		return err
+	}
+
+	server := &Server{provider: provider}
+
+	if id := firstNonEmpty(*model, os.Getenv("COPILOT_MODEL"), appConfig.modelFor("copilot")); id != "" {
+		if err := server.setModel(context.Background(), id); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Listening on http://%s/v1\n", *address)
+
+	return http.ListenAndServe(*address, server.Handler())
+}
+
+// setModel selects the model of the requests without one. The models are
+// listed first so an unknown one is rejected on startup.
+func (s *Server) setModel(ctx context.Context, id string) error {
+	s.provider.loadModels(ctx)
+
+	return s.provider.SetModel(id)
+}
+
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("/v1/models", s.handleModels)
+
+	return mux
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use GET")
+
+		return
+	}
+
+	available, err := s.provider.Models(r.Context())
+
+	if err != nil {
+		writeError(w, statusForError(err), "models_unavailable", err.Error())
+
+		return
+	}
+
+	models := ModelList{Object: "list", Data: []ModelObject{}}
+
+	for _, model := range available {
+		models.Data = append(models.Data, ModelObject{ID: model.ID, Object: "model", OwnedBy: firstNonEmpty(model.Vendor, "github-copilot")})
+	}
+
+	w.Header().Set("content-type", "application/json")
+
+	json.NewEncoder(w).Encode(models)
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "use POST")
+
+		return
+	}
+
+	start := time.Now()
+
+	body, err := translateRequest(r.Body, s.provider.Model().ID)
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", err.Error())
+
+		return
+	}
+
+	c, err := s.provider.session(r.Context())
+
+	if err != nil {
+		writeError(w, statusForError(err), "invalid_token", err.Error())
+
+		return
+	}
+
+	req, err := newCompletionRequest(r.Context(), &c, body)
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal_error", err.Error())
+
+		return
+	}
+
+	resp, err := doCompletionRequest(req)
+
+	if err != nil {
+		writeError(w, http.StatusBadGateway, "bad_gateway", err.Error())
+
+		return
+	}
+
+	defer resp.Body.Close()
+
+	relayResponse(w, resp)
+
+	log.Println("Proxied chat completion:", resp.Status, time.Since(start))
+}
+
+// translateRequest adds the fields Copilot expects to an OpenAI request while
+// keeping everything else untouched.
+func translateRequest(body io.Reader, defaultModel string) ([]byte, error) {
+	var request map[string]interface{}
+
+	err := json.NewDecoder(body).Decode(&request)
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the request body: %w", err)
+	}
+
+	messages, ok := request["messages"].([]interface{})
+
+	if !ok || len(messages) == 0 {
+		return nil, fmt.Errorf("messages is required")
+	}
+
+	if model, ok := request["model"].(string); !ok || model == "" {
+		request["model"] = defaultModel
+	}
+
+	request["intent"] = true
+
+	return json.Marshal(request)
+}
+
+// relayResponse copies the Copilot response back as is, flushing every chunk
+// so the SSE stream reaches the client as it is produced.
+func relayResponse(w http.ResponseWriter, resp *http.Response) {
+	for _, header := range []string{"content-type", "content-encoding", "cache-control"} {
+		if value := resp.Header.Get(header); value != "" {
+			w.Header().Set(header, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	buffer := make([]byte, 4096)
+
+	for {
+		n, err := resp.Body.Read(buffer)
+
+		if n > 0 {
+			if _, err := w.Write(buffer[:n]); err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func statusForError(err error) int {
+	var providerError *ProviderError
+
+	if errors.As(err, &providerError) && providerError.Status != 0 {
+		return providerError.Status
+	}
+
+	switch {
+	case errors.Is(err, &ProviderError{Kind: ErrorNetwork}):
+		return http.StatusBadGateway
+	case errors.Is(err, &ProviderError{Kind: ErrorRateLimited}):
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusUnauthorized
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorDetails{
+		Code:    code,
+		Message: message,
+		Type:    "gopilot_error",
+	}})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranslateRequest(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]interface{}
+		wantErr bool
+	}{
+		{`{"messages":[{"role":"user","content":"hi"}],"stream":true,"top_p":0.9}`, map[string]interface{}{"model": "gpt-4", "intent": true, "stream": true, "top_p": 0.9}, false},
+		{`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"tools":[]}`, map[string]interface{}{"model": "gpt-3.5-turbo", "intent": true}, false},
+		{`{"model":"gpt-4"}`, nil, true},
+		{`not json`, nil, true},
+	}
+
+	for _, tt := range tests {
+		body, err := translateRequest(strings.NewReader(tt.input), "gpt-4")
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("got %v want error %t", err, tt.wantErr)
+		}
+
+		if err != nil {
+			continue
+		}
+
+		var got map[string]interface{}
+
+		json.Unmarshal(body, &got)
+
+		for key, value := range tt.want {
+			if got[key] != value {
+				t.Errorf("got %s=%v want %v", key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestServeModels(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	server := &Server{provider: NewCopilotProvider(fake.Endpoints())}
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/v1/models", nil))
+
+	var models ModelList
+
+	if err := json.NewDecoder(recorder.Body).Decode(&models); err != nil {
+		t.Fatal(err)
+	}
+
+	if models.Object != "list" || len(models.Data) != 2 || models.Data[1].ID != "gpt-4o" {
+		t.Errorf("got %+v want the %d chat models", models, 2)
+	}
+}
+
+func TestServeSetModel(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	server := &Server{provider: NewCopilotProvider(fake.Endpoints())}
+
+	if err := server.setModel(context.Background(), "typo"); err == nil {
+		t.Errorf("got no error want an unknown model")
+	}
+
+	if err := server.setModel(context.Background(), "gpt-4o"); err != nil {
+		t.Fatal(err)
+	}
+
+	if server.provider.Model().ID != "gpt-4o" {
+		t.Errorf("got %s want %s", server.provider.Model().ID, "gpt-4o")
+	}
+}
+
+func TestServeChatCompletionsErrors(t *testing.T) {
+	setConfigHome(t)
+
+	server := &Server{provider: NewCopilotProvider(DefaultCopilotEndpoints)}
+
+	tests := []struct {
+		method string
+		body   string
+		want   int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", "not json", http.StatusBadRequest},
+		{"POST", `{"messages":[{"role":"user","content":"hi"}]}`, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(tt.method, "/v1/chat/completions", strings.NewReader(tt.body)))
+
+		if recorder.Code != tt.want {
+			t.Errorf("got %d want %d", recorder.Code, tt.want)
+		}
+
+		var response ErrorResponse
+
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil || response.Error.Message == "" {
+			t.Errorf("got %v want an error body", err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const SESSION_TITLE_LENGTH = 60
+
+// Session is a conversation saved to disk. Messages is the transcript shown
+// in the viewport while History is what gets sent to the provider.
+type Session struct {
+	ID        string           `json:"id"`
+	Title     string           `json:"title"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Messages  []HistoryMessage `json:"messages"`
+	History   []HistoryMessage `json:"history"`
+	Params    GenerationParams `json:"params"`
+}
+
+func newSession() Session {
+	now := time.Now()
+
+	return Session{
+		ID:        now.Format("20060102-150405") + "-" + uuid()[:8],
+		CreatedAt: now,
+		Params:    DefaultGenerationParams,
+	}
+}
+
+func sessionsDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+
+		if err != nil {
+			return "", err
+		}
+
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dataHome, "gopilot", "sessions"), nil
+}
+
+func sessionPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("invalid session id %q", id)
+	}
+
+	dir, err := sessionsDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// hasConversation reports whether the session contains at least one question
+// worth saving.
+func (s Session) hasConversation() bool {
+	for _, message := range s.History {
+		if message.Role == "user" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func saveSession(s Session) error {
+	path, err := sessionPath(s.ID)
+
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(s, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a truncated session
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, content, 0600)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func loadSession(id string) (Session, error) {
+	var session Session
+
+	path, err := sessionPath(id)
+
+	if err != nil {
+		return session, err
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return session, err
+	}
+
+	err = json.Unmarshal(content, &session)
+
+	if err != nil {
+		return session, fmt.Errorf("cannot parse session %s: %w", id, err)
+	}
+
+	return session, nil
+}
+
+func deleteSession(id string) error {
+	path, err := sessionPath(id)
+
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+// listSessions returns the saved sessions, most recently updated first.
+func listSessions() ([]Session, error) {
+	dir, err := sessionsDir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		session, err := loadSession(strings.TrimSuffix(entry.Name(), ".json"))
+
+		if err != nil {
+			continue
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
+
+func latestSession() (Session, error) {
+	sessions, err := listSessions()
+
+	if err != nil {
+		return Session{}, err
+	}
+
+	if len(sessions) == 0 {
+		return Session{}, errors.New("there are no saved sessions")
+	}
+
+	return sessions[0], nil
+}
+
+// sessionTitle uses the first line of the first question as the title.
+// Preloaded context, which starts with a code fence, is skipped.
+func sessionTitle(history []HistoryMessage) string {
+	for _, message := range history {
+		title := strings.TrimSpace(message.Content)
+
+		if message.Role != "user" || strings.HasPrefix(title, "```") {
+			continue
+		}
+
+		if i := strings.IndexByte(title, '\n'); i != -1 {
+			title = title[:i]
+		}
+
+		if runes := []rune(title); len(runes) > SESSION_TITLE_LENGTH {
+			title = string(runes[:SESSION_TITLE_LENGTH]) + "…"
+		}
+
+		return title
+	}
+
+	return "New conversation"
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionTitle(t *testing.T) {
+	tests := []struct {
+		history []HistoryMessage
+		want    string
+	}{
+		{[]HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("How do I reverse a slice?")}, "How do I reverse a slice?"},
+		{[]HistoryMessage{createHistoryEntry("  first line\nsecond line")}, "first line"},
+		{[]HistoryMessage{createHistoryEntry("0123456789012345678901234567890123456789012345678901234567890123456789")}, "012345678901234567890123456789012345678901234567890123456789…"},
+		{[]HistoryMessage{createSystemHistoryEntry("system")}, "New conversation"},
+		{[]HistoryMessage{createHistoryEntry("```\npanic: oops\n```"), createHistoryEntry("What does this mean?")}, "What does this mean?"},
+	}
+
+	for _, tt := range tests {
+		got := sessionTitle(tt.history)
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
+
+func TestSaveAndLoadSessions(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	older := newSession()
+	older.ID = "older"
+	older.Title = "older"
+	older.UpdatedAt = time.Now().Add(-time.Hour)
+	older.History = []HistoryMessage{createSystemHistoryEntry("system"), createHistoryEntry("hi")}
+
+	newer := newSession()
+	newer.ID = "newer"
+	newer.Title = "newer"
+	newer.UpdatedAt = time.Now()
+	newer.Messages = []HistoryMessage{createHistoryEntry("hello"), createBotHistoryEntry("hi!")}
+	newer.Params = GenerationParams{Temperature: 0.8, TopP: 0.95, MaxTokens: 512, N: 2}
+
+	for _, session := range []Session{older, newer} {
+		if err := saveSession(session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sessions, err := listSessions()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 2 || sessions[0].ID != "newer" || sessions[1].ID != "older" {
+		t.Fatalf("got %v want [newer older]", sessions)
+	}
+
+	got, err := loadSession("newer")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Messages) != 2 || got.Messages[1].Content != "hi!" {
+		t.Errorf("got %v want %v", got.Messages, newer.Messages)
+	}
+
+	if got.Params != newer.Params {
+		t.Errorf("got %+v want %+v", got.Params, newer.Params)
+	}
+
+	latest, err := latestSession()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if latest.ID != "newer" {
+		t.Errorf("got %s want %s", latest.ID, "newer")
+	}
+}
+
+func TestListSessionsEmpty(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+
+	sessions, err := listSessions()
+
+	if err != nil || len(sessions) != 0 {
+		t.Errorf("got %v, %v want no sessions", sessions, err)
+	}
+
+	if _, err := latestSession(); err == nil {
+		t.Errorf("Expected an error without sessions")
+	}
+}
+
+func TestSessionPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/data")
+
+	tests := []struct {
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{"20240101-120000-abcdefgh", "/data/gopilot/sessions/20240101-120000-abcdefgh.json", false},
+		{"../escape", "", true},
+		{"", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := sessionPath(tt.id)
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("got %v want error %t", err, tt.wantErr)
+		}
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
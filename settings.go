@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var settingsTitleStyle = lipgloss.NewStyle().Bold(true).MarginBottom(1)
+
+const (
+	temperatureField = iota
+	topPField
+	maxTokensField
+	nField
+)
+
+var settingsLabels = []string{"Temperature", "Top P", "Max tokens", "N"}
+
+type settingsKeyMap struct {
+	Next   key.Binding
+	Prev   key.Binding
+	Save   key.Binding
+	Cancel key.Binding
+}
+
+var settingsKeys = settingsKeyMap{
+	Next: key.NewBinding(
+		key.WithKeys("tab", "down"),
+		key.WithHelp("tab", "next field"),
+	),
+	Prev: key.NewBinding(
+		key.WithKeys("shift+tab", "up"),
+		key.WithHelp("shift+tab", "previous field"),
+	),
+	Save: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "save"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "cancel"),
+	),
+}
+
+func (k settingsKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Next, k.Prev, k.Save, k.Cancel}
+}
+
+func (k settingsKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.ShortHelp()}
+}
+
+// settings edits the generation parameters of the current session.
+type settings struct {
+	inputs    []textinput.Model
+	focus     int
+	maxOutput int
+	err       error
+	help      help.Model
+}
+
+func newSettings(params GenerationParams, maxOutput int) settings {
+	values := []string{
+		formatFloat(params.Temperature),
+		formatFloat(params.TopP),
+		strconv.Itoa(params.MaxTokens),
+		strconv.Itoa(params.N),
+	}
+
+	s := settings{maxOutput: maxOutput, help: help.New()}
+
+	for i, value := range values {
+		input := textinput.New()
+		input.Prompt = fmt.Sprintf("%-12s ", settingsLabels[i])
+		input.CharLimit = 8
+		input.SetValue(value)
+
+		s.inputs = append(s.inputs, input)
+	}
+
+	s.inputs[0].Focus()
+
+	return s
+}
+
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'g', -1, 32)
+}
+
+// params parses and validates the fields.
+func (s settings) params() (GenerationParams, error) {
+	var params GenerationParams
+
+	temperature, err := strconv.ParseFloat(strings.TrimSpace(s.inputs[temperatureField].Value()), 32)
+
+	if err != nil {
+		return params, fmt.Errorf("temperature must be a number")
+	}
+
+	topP, err := strconv.ParseFloat(strings.TrimSpace(s.inputs[topPField].Value()), 32)
+
+	if err != nil {
+		return params, fmt.Errorf("top_p must be a number")
+	}
+
+	maxTokens, err := strconv.Atoi(strings.TrimSpace(s.inputs[maxTokensField].Value()))
+
+	if err != nil {
+		return params, fmt.Errorf("max_tokens must be an integer")
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(s.inputs[nField].Value()))
+
+	if err != nil {
+		return params, fmt.Errorf("n must be an integer")
+	}
+
+	params = GenerationParams{
+		Temperature: float32(temperature),
+		TopP:        float32(topP),
+		MaxTokens:   maxTokens,
+		N:           n,
+	}
+
+	return params, params.validate(s.maxOutput)
+}
+
+func (s *settings) move(offset int) tea.Cmd {
+	s.inputs[s.focus].Blur()
+	s.focus = (s.focus + offset + len(s.inputs)) % len(s.inputs)
+
+	return s.inputs[s.focus].Focus()
+}
+
+func (s settings) View() string {
+	views := []string{settingsTitleStyle.Render("Generation settings")}
+
+	for _, input := range s.inputs {
+		views = append(views, input.View())
+	}
+
+	hint := "Max tokens 0 uses the model limit"
+
+	if s.maxOutput > 0 {
+		hint += fmt.Sprintf(" (%d)", s.maxOutput)
+	}
+
+	views = append(views, "", footerStyle.Render(hint+". Only the first of N answers is shown."))
+
+	if s.err != nil {
+		views = append(views, errorStyle.Render(s.err.Error()))
+	}
+
+	views = append(views, "", s.help.View(settingsKeys))
+
+	return lipgloss.JoinVertical(lipgloss.Left, views...)
+}
+
+// fitParams clamps the settings of the session to the current model before
+// they are sent, telling the user what was changed.
+func (m model) fitParams() model {
+	params, changes := m.session.Params.orDefault().clamp(m.modelInfo().MaxOutput)
+
+	if changes == "" {
+		return m
+	}
+
+	log.Println(changes)
+
+	m.session.Params = params
+
+	return m.showError(errors.New(changes))
+}
+
+// openSettings shows the settings of the current session, the max tokens are
+// checked against the limit of the current model when it is known.
+func (m model) openSettings() (model, tea.Cmd) {
+	maxOutput := 0
+
+	if switcher, ok := m.provider.(ModelSwitcher); ok {
+		maxOutput = switcher.Model().MaxOutput
+	}
+
+	m.settings = newSettings(m.session.Params.orDefault(), maxOutput)
+	m.editingSettings = true
+
+	return m, textinput.Blink
+}
+
+// updateSettings handles the messages while the settings panel is open.
+func (m model) updateSettings(msg tea.Msg) (model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	keyMsg, isKey := msg.(tea.KeyMsg)
+
+	if isKey {
+		switch {
+		case key.Matches(keyMsg, m.keys.Quit):
+			return m, tea.Quit
+
+		case key.Matches(keyMsg, settingsKeys.Cancel):
+			m.editingSettings = false
+
+			return m, nil
+
+		case key.Matches(keyMsg, settingsKeys.Next):
+			return m, m.settings.move(1)
+
+		case key.Matches(keyMsg, settingsKeys.Prev):
+			return m, m.settings.move(-1)
+
+		case key.Matches(keyMsg, settingsKeys.Save):
+			params, err := m.settings.params()
+
+			if err != nil {
+				m.settings.err = err
+
+				return m, nil
+			}
+
+			m.editingSettings = false
+			m.session.Params = params
+
+			return m, m.persist()
+		}
+	}
+
+	m.settings.inputs[m.settings.focus], cmd = m.settings.inputs[m.settings.focus].Update(msg)
+
+	return m, cmd
+}
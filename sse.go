@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// MAX_EVENT_SIZE bounds a single line of the stream, a longer line is
+// reported as an error instead of growing the buffer forever.
+const MAX_EVENT_SIZE = 16 * 1024 * 1024
+
+const SSE_DONE = "[DONE]"
+
+// Event is a server-sent event as described by the HTML spec.
+type Event struct {
+	Event string
+	ID    string
+	Data  string
+}
+
+// EventDecoder reads server-sent events from a stream. It follows the spec:
+// lines end with CRLF, LF or CR, lines starting with ":" are comments, the
+// data lines of an event are joined with "\n" and a blank line dispatches the
+// event. It is lenient in two ways: leading blanks before a field name are
+// ignored and a pending event is dispatched at the end of the stream.
+type EventDecoder struct {
+	scanner *bufio.Scanner
+	lastID  string
+}
+
+func NewEventDecoder(r io.Reader) *EventDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MAX_EVENT_SIZE)
+	scanner.Split(scanLines)
+
+	return &EventDecoder{scanner: scanner}
+}
+
+// Next returns the next event with data, or io.EOF once the stream is over.
+func (d *EventDecoder) Next() (Event, error) {
+	var event Event
+	var data strings.Builder
+	hasData := false
+
+	for d.scanner.Scan() {
+		line := strings.TrimLeft(d.scanner.Text(), " \t")
+
+		if line == "" {
+			if hasData {
+				event.ID = d.lastID
+				event.Data = strings.TrimSuffix(data.String(), "\n")
+
+				return event, nil
+			}
+
+			event = Event{}
+
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				d.lastID = value
+			}
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		}
+	}
+
+	if err := d.scanner.Err(); err != nil {
+		return Event{}, err
+	}
+
+	if hasData {
+		event.ID = d.lastID
+		event.Data = strings.TrimSuffix(data.String(), "\n")
+
+		return event, nil
+	}
+
+	return Event{}, io.EOF
+}
+
+// scanLines is bufio.ScanLines accepting CRLF, LF and a lone CR as the end
+// of a line.
+func scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+
+		// Wait for the next byte to know whether the CR is followed by a LF
+		if i+1 == len(data) && !atEOF {
+			return 0, nil, nil
+		}
+
+		if i+1 < len(data) && data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func decodeEvents(r io.Reader) ([]Event, error) {
+	decoder := NewEventDecoder(r)
+	events := []Event{}
+
+	for {
+		event, err := decoder.Next()
+
+		if err == io.EOF {
+			return events, nil
+		}
+
+		if err != nil {
+			return events, err
+		}
+
+		events = append(events, event)
+	}
+}
+
+func TestEventDecoder(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []Event
+	}{
+		{"data: hello\n\n", []Event{{Data: "hello"}}},
+		{"data: hello\r\n\r\ndata: bye\r\r", []Event{{Data: "hello"}, {Data: "bye"}}},
+		{"data: first\ndata: second\n\n", []Event{{Data: "first\nsecond"}}},
+		{": comment\ndata: hello\n: another\n\n", []Event{{Data: "hello"}}},
+		{"event: delta\nid: 7\ndata: hello\n\ndata: bye\n\n", []Event{{Event: "delta", ID: "7", Data: "hello"}, {ID: "7", Data: "bye"}}},
+		{"event: ping\n\ndata: hello\n\n", []Event{{Data: "hello"}}},
+		{"data:no space\n\ndata:  two spaces\n\n", []Event{{Data: "no space"}, {Data: " two spaces"}}},
+		{"data\n\n", []Event{{Data: ""}}},
+		{"retry: 1000\nunknown: field\ndata: hello\n\n", []Event{{Data: "hello"}}},
+		{"\t  data: indented\n\n", []Event{{Data: "indented"}}},
+		{"data: no trailing newline", []Event{{Data: "no trailing newline"}}},
+		{"data: [DONE]\n\n", []Event{{Data: SSE_DONE}}},
+		{"", []Event{}},
+		{"\n\n\n", []Event{}},
+	}
+
+	for _, tt := range tests {
+		got, err := decodeEvents(strings.NewReader(tt.input))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: got %+v want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestEventDecoderTooLong(t *testing.T) {
+	_, err := decodeEvents(strings.NewReader("data: " + strings.Repeat("a", MAX_EVENT_SIZE) + "\n\n"))
+
+	if err == nil {
+		t.Errorf("got nil want an error for a line longer than %d bytes", MAX_EVENT_SIZE)
+	}
+}
+
+// FuzzEventDecoder checks that the events do not depend on how the stream is
+// split in reads nor on the line endings.
+func FuzzEventDecoder(f *testing.F) {
+	f.Add("data: hello\n\n")
+	f.Add("data: first\ndata: second\n\ndata: [DONE]\n\n")
+	f.Add(": comment\nevent: delta\nid: 1\ndata: {\"choices\":[]}\n\n")
+	f.Add("data: hello\r\n\r\ndata: bye\r\r")
+	f.Add("data")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		// A CR directly followed by a LF would become a single line ending
+		if strings.Contains(input, "\r") {
+			return
+		}
+
+		want, err := decodeEvents(strings.NewReader(input))
+
+		if err != nil {
+			t.Skip()
+		}
+
+		for _, event := range want {
+			if strings.ContainsAny(event.Data, "\r") || strings.ContainsAny(event.Event+event.ID, "\r\n") {
+				t.Errorf("got %+v want no line endings in the fields", event)
+			}
+		}
+
+		got, err := decodeEvents(iotest.OneByteReader(strings.NewReader(input)))
+
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v %v want %+v when reading one byte at a time", got, err, want)
+		}
+
+		for _, ending := range []string{"\r\n", "\r"} {
+			got, err := decodeEvents(strings.NewReader(strings.ReplaceAll(input, "\n", ending)))
+
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v %v want %+v with %q line endings", got, err, want, ending)
+			}
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// readPipedInput returns the content piped or redirected to stdin. Any other
+// stdin, like a terminal, a socket or /dev/null, is not read.
+func readPipedInput(stdin *os.File) (string, error) {
+	info, err := stdin.Stat()
+
+	if err != nil {
+		return "", nil
+	}
+
+	if info.Mode()&os.ModeNamedPipe == 0 && !info.Mode().IsRegular() {
+		return "", nil
+	}
+
+	content, err := io.ReadAll(stdin)
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+// attachInput appends the piped input to the prompt as a fenced block. The
+// fence is made longer than any backtick run in the input so it cannot be
+// closed early.
+func attachInput(prompt string, input string) string {
+	input = strings.TrimRight(input, "\r\n")
+
+	if strings.TrimSpace(input) == "" {
+		return prompt
+	}
+
+	longest := 0
+	run := 0
+
+	for _, c := range input {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+
+	fence := strings.Repeat("`", max(3, longest+1))
+	block := fence + "\n" + input + "\n" + fence
+
+	if prompt == "" {
+		return block
+	}
+
+	return prompt + "\n\n" + block
+}
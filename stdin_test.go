@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachInput(t *testing.T) {
+	tests := []struct {
+		prompt string
+		input  string
+		want   string
+	}{
+		{"review this", "diff --git a/main.go\n", "review this\n\n```\ndiff --git a/main.go\n```"},
+		{"", "panic: oops\n", "```\npanic: oops\n```"},
+		{"explain", "```go\nfmt.Println()\n```\n", "explain\n\n````\n```go\nfmt.Println()\n```\n````"},
+		{"question", "  \n", "question"},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		got := attachInput(tt.prompt, tt.input)
+
+		if got != tt.want {
+			t.Errorf("got %q want %q", got, tt.want)
+		}
+	}
+}
+
+func TestReadPipedInput(t *testing.T) {
+	r, w, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w.WriteString("piped content")
+	w.Close()
+
+	got, err := readPipedInput(r)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != "piped content" {
+		t.Errorf("got %s want %s", got, "piped content")
+	}
+}
+
+func TestReadPipedInputOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+
+	if err := os.WriteFile(path, []byte("redirected content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path, "redirected content"},
+		// A character device, like a terminal, is not read
+		{os.DevNull, ""},
+	}
+
+	for _, tt := range tests {
+		file, err := os.Open(tt.path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := readPipedInput(file)
+
+		file.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MIN_TOKEN_REFRESH_DELAY keeps a failing or short-lived token from being
+// refreshed in a loop.
+const MIN_TOKEN_REFRESH_DELAY = 10 * time.Second
+
+// tokenRefreshMargin is how long before its expiration a token is refreshed.
+var tokenRefreshMargin = 5 * time.Minute
+
+// TOKEN_EXPIRY_MARGIN is how long before its expiration a token is no longer
+// used, so it does not expire while a request is sent.
+const TOKEN_EXPIRY_MARGIN = time.Minute
+
+// CachedToken is a Copilot token saved across runs. The GitHub token is never
+// written, the entries are keyed by its hash.
+type CachedToken struct {
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+// tokenCacheMu serializes the writes of the providers of this process.
+var tokenCacheMu sync.Mutex
+
+func tokenCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "gopilot", "tokens.json"), nil
+}
+
+// tokenCacheKey tells apart the tokens of every account and host.
+func tokenCacheKey(account GithubAccount, tokenURL string) string {
+	sum := sha256.Sum256([]byte(tokenURL + " " + account.OAuthToken))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func readTokenCache() map[string]CachedToken {
+	cache := map[string]CachedToken{}
+
+	path, err := tokenCachePath()
+
+	if err != nil {
+		return cache
+	}
+
+	content, err := os.ReadFile(path)
+
+	if err != nil {
+		return cache
+	}
+
+	// A broken cache is just ignored, it is written again on the next token
+	if err := json.Unmarshal(content, &cache); err != nil {
+		log.Println("Ignoring the token cache:", err)
+
+		return map[string]CachedToken{}
+	}
+
+	return cache
+}
+
+func writeTokenCache(cache map[string]CachedToken) error {
+	path, err := tokenCachePath()
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(cache)
+
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// loadCachedToken returns the cached token of the account while it is valid.
+func loadCachedToken(account GithubAccount, tokenURL string) (string, bool) {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	cached, ok := readTokenCache()[tokenCacheKey(account, tokenURL)]
+
+	if !ok || isExpired(cached.ExpiresAt) {
+		return "", false
+	}
+
+	return cached.Token, true
+}
+
+// saveCachedToken also drops the expired tokens of other accounts.
+func saveCachedToken(account GithubAccount, tokenURL string, token string) {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	cache := readTokenCache()
+
+	for key, cached := range cache {
+		if isExpired(cached.ExpiresAt) {
+			delete(cache, key)
+		}
+	}
+
+	cache[tokenCacheKey(account, tokenURL)] = CachedToken{Token: token, ExpiresAt: extractExpiration(token)}
+
+	if err := writeTokenCache(cache); err != nil {
+		log.Println("Cannot cache the token:", err)
+	}
+}
+
+// forgetCachedToken removes a token that was rejected or has to be reloaded.
+func forgetCachedToken(account GithubAccount, tokenURL string) {
+	tokenCacheMu.Lock()
+	defer tokenCacheMu.Unlock()
+
+	cache := readTokenCache()
+	key := tokenCacheKey(account, tokenURL)
+
+	if _, ok := cache[key]; !ok {
+		return
+	}
+
+	delete(cache, key)
+
+	if err := writeTokenCache(cache); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Println("Cannot update the token cache:", err)
+	}
+}
+
+// cachedToken returns the cached token of the account, or a new one that is
+// cached for the next runs.
+func cachedToken(ctx context.Context, name string, tokenURL string) (string, error) {
+	account, err := readAccount(name)
+
+	if err != nil {
+		return "", err
+	}
+
+	if token, ok := loadCachedToken(account, tokenURL); ok {
+		log.Println("Using the cached token")
+
+		return token, nil
+	}
+
+	token, err := requestToken(ctx, account, tokenURL)
+
+	if err != nil {
+		return "", err
+	}
+
+	saveCachedToken(account, tokenURL, token)
+
+	return token, nil
+}
+
+// refreshDelay is how long until the token has to be refreshed.
+func refreshDelay(token string) time.Duration {
+	expiration := time.Unix(extractExpiration(token), 0)
+
+	return max(time.Until(expiration.Add(-tokenRefreshMargin)), MIN_TOKEN_REFRESH_DELAY)
+}
+
+// scheduleRefresh plans the background refresh of the current token, p.mu is
+// held.
+func (p *CopilotProvider) scheduleRefresh() {
+	if p.refreshTimer != nil {
+		p.refreshTimer.Stop()
+	}
+
+	p.refreshTimer = time.AfterFunc(refreshDelay(p.request.Token), p.refreshInBackground)
+}
+
+// refreshInBackground replaces the token before it expires so no request has
+// to wait for a new one. When it fails the token is renewed by the next
+// request instead.
+func (p *CopilotProvider) refreshInBackground() {
+	p.mu.Lock()
+	c := p.request
+	p.mu.Unlock()
+
+	account, err := readAccount(c.Account)
+
+	if err != nil {
+		log.Println("Cannot refresh the token:", err)
+
+		return
+	}
+
+	token, err := requestToken(context.Background(), account, c.Endpoints.TokenURL)
+
+	if err != nil {
+		log.Println("Cannot refresh the token:", err)
+
+		return
+	}
+
+	saveCachedToken(account, c.Endpoints.TokenURL, token)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	log.Println("Refreshed the token in the background")
+
+	p.request.Token = token
+	p.scheduleRefresh()
+}
+
+// renew makes sure the token is valid, a new token gets its refresh planned.
+// The token is fetched without holding p.mu, p.tokenMu is held.
+func (p *CopilotProvider) renew(ctx context.Context) (CopilotRequest, error) {
+	p.mu.Lock()
+	c := p.request
+	p.mu.Unlock()
+
+	token := c.Token
+
+	if err := renewToken(ctx, &c); err != nil {
+		return c, err
+	}
+
+	if c.Token == token {
+		return c, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.request.Token = c.Token
+	p.scheduleRefresh()
+
+	return p.request, nil
+}
+
+// forgetToken drops the token of the session from the cache, so the next one
+// comes from the token API.
+func forgetToken(c CopilotRequest) {
+	if account, err := readAccount(c.Account); err == nil {
+		forgetCachedToken(account, c.Endpoints.TokenURL)
+	}
+}
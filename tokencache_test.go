@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sendHi(t *testing.T, provider *CopilotProvider) {
+	_, err := provider.Send(context.Background(), []HistoryMessage{createHistoryEntry("hi")}, func(string, bool, bool) {})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenCache(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+
+	// A second run reuses the token of the first one
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+
+	if fake.TokenRequests != 1 {
+		t.Errorf("got %d want %d", fake.TokenRequests, 1)
+	}
+
+	if fake.CompletionHeaders[0].Get("authorization") != fake.CompletionHeaders[1].Get("authorization") {
+		t.Errorf("The second run did not use the cached token")
+	}
+
+	path, _ := tokenCachePath()
+	info, err := os.Stat(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("got %o want %o", info.Mode().Perm(), 0600)
+	}
+
+	content, _ := os.ReadFile(path)
+
+	if strings.Contains(string(content), FAKE_OAUTH_TOKEN) {
+		t.Errorf("The GitHub token was cached")
+	}
+}
+
+func TestTokenCacheExpired(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want int
+	}{
+		{-time.Hour, 2},
+		// Recently expired or about to expire
+		{-30 * time.Second, 2},
+		{30 * time.Second, 2},
+		{time.Hour, 1},
+	}
+
+	for _, tt := range tests {
+		writeHostsFile(t)
+
+		fake := NewFakeCopilot(t)
+		fake.TokenTTL = tt.ttl
+
+		// An expired token is never taken from the cache
+		NewCopilotProvider(fake.Endpoints()).session(context.Background())
+		NewCopilotProvider(fake.Endpoints()).session(context.Background())
+
+		if fake.TokenRequests != tt.want {
+			t.Errorf("got %d want %d", fake.TokenRequests, tt.want)
+		}
+	}
+}
+
+func TestModelWhileFetchingToken(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+	fake.TokenDelay = time.Second
+
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	go provider.session(context.Background())
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The UI reads the model on every render, it must not wait for the token
+	read := make(chan ModelInfo)
+
+	go func() { read <- provider.Model() }()
+
+	select {
+	case model := <-read:
+		if model.ID != DEFAULT_COPILOT_MODEL {
+			t.Errorf("got %s want %s", model.ID, DEFAULT_COPILOT_MODEL)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Errorf("Model() waited for the token")
+	}
+}
+
+func TestTokenCancelled(t *testing.T) {
+	writeHostsFile(t)
+
+	policy := retryPolicy
+
+	retryPolicy.BaseDelay = time.Second
+	t.Cleanup(func() { retryPolicy = policy })
+
+	fake := NewFakeCopilot(t)
+	fake.TokenStatus = http.StatusServiceUnavailable
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The token API is not retried once the request is cancelled
+	_, err := NewCopilotProvider(fake.Endpoints()).session(ctx)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v want %v", err, context.DeadlineExceeded)
+	}
+
+	if fake.TokenRequests != 1 {
+		t.Errorf("got %d want %d", fake.TokenRequests, 1)
+	}
+}
+
+func TestTokenCacheReload(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+
+	// Reloading skips the cache and replaces the cached token
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	if err := provider.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+
+	if fake.TokenRequests != 2 {
+		t.Errorf("got %d want %d", fake.TokenRequests, 2)
+	}
+
+	if !strings.HasPrefix(fake.CompletionHeaders[1].Get("authorization"), "Bearer tid=2;") {
+		t.Errorf("got %s want the reloaded token", fake.CompletionHeaders[1].Get("authorization"))
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	expiring := func(d time.Duration) string {
+		return fmt.Sprintf("tid=1;exp=%d", time.Now().Add(d).Unix())
+	}
+
+	tests := []struct {
+		token string
+		min   time.Duration
+		max   time.Duration
+	}{
+		{expiring(30 * time.Minute), 24 * time.Minute, 25 * time.Minute},
+		{expiring(time.Minute), MIN_TOKEN_REFRESH_DELAY, MIN_TOKEN_REFRESH_DELAY},
+		{"", MIN_TOKEN_REFRESH_DELAY, MIN_TOKEN_REFRESH_DELAY},
+	}
+
+	for _, tt := range tests {
+		got := refreshDelay(tt.token)
+
+		if got < tt.min || got > tt.max {
+			t.Errorf("got %s want between %s and %s", got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestRefreshInBackground(t *testing.T) {
+	writeHostsFile(t)
+
+	fake := NewFakeCopilot(t)
+
+	provider := NewCopilotProvider(fake.Endpoints())
+
+	sendHi(t, provider)
+
+	if provider.refreshTimer == nil {
+		t.Fatal("The refresh was not scheduled")
+	}
+
+	provider.refreshInBackground()
+
+	sendHi(t, provider)
+
+	// The send did not wait for a token, it was already refreshed
+	if fake.TokenRequests != 2 {
+		t.Errorf("got %d want %d", fake.TokenRequests, 2)
+	}
+
+	if !strings.HasPrefix(fake.CompletionHeaders[1].Get("authorization"), "Bearer tid=2;") {
+		t.Errorf("got %s want the refreshed token", fake.CompletionHeaders[1].Get("authorization"))
+	}
+
+	// The next run gets the refreshed token from the cache
+	sendHi(t, NewCopilotProvider(fake.Endpoints()))
+
+	if fake.CompletionHeaders[2].Get("authorization") != fake.CompletionHeaders[1].Get("authorization") {
+		t.Errorf("The refreshed token was not cached")
+	}
+}
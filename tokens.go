@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// DEFAULT_CONTEXT_WINDOW is used for the models with unknown limits.
+const DEFAULT_CONTEXT_WINDOW = 32768
+
+// MESSAGE_OVERHEAD_TOKENS accounts for the role and the separators the chat
+// format adds around every message.
+const MESSAGE_OVERHEAD_TOKENS = 4
+
+// estimateTokens approximates the tokens of a text without the tokenizer of
+// the model, about 4 characters per token for English and code.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func messageTokens(message HistoryMessage) int {
+	return estimateTokens(message.Content) + MESSAGE_OVERHEAD_TOKENS
+}
+
+func historyTokens(history []HistoryMessage) int {
+	tokens := 0
+
+	for _, message := range history {
+		tokens += messageTokens(message)
+	}
+
+	return tokens
+}
+
+// promptBudget is how many tokens the history can take, leaving room for the
+// answer in the context window.
+func promptBudget(model ModelInfo, params GenerationParams) int {
+	if model.MaxPrompt > 0 {
+		return model.MaxPrompt
+	}
+
+	output := DEFAULT_MAX_TOKENS
+
+	switch {
+	case params.MaxTokens > 0:
+		output = params.MaxTokens
+	case model.MaxOutput > 0:
+		output = model.MaxOutput
+	}
+
+	window := DEFAULT_CONTEXT_WINDOW
+
+	if model.ContextWindow > 0 {
+		window = model.ContextWindow
+	}
+
+	return max(window-output, window/2)
+}
+
+// truncateHistory drops the oldest turns until the history fits in budget.
+// The leading system messages and the last turn are always kept, so the
+// result can still be over budget. It returns how many messages were dropped.
+func truncateHistory(history []HistoryMessage, budget int) ([]HistoryMessage, int) {
+	system := 0
+
+	for system < len(history) && history[system].Role == "system" {
+		system++
+	}
+
+	turns := history[system:]
+	tokens := historyTokens(history)
+	dropped := 0
+
+	for tokens > budget {
+		// A turn is a user message followed by the replies to it
+		end := 1
+
+		for end < len(turns) && turns[end].Role != "user" {
+			end++
+		}
+
+		if end >= len(turns) {
+			break
+		}
+
+		tokens -= historyTokens(turns[:end])
+		dropped += end
+		turns = turns[end:]
+	}
+
+	if dropped == 0 {
+		return history, 0
+	}
+
+	truncated := append([]HistoryMessage(nil), history[:system]...)
+
+	return append(truncated, turns...), dropped
+}
+
+// formatTokens shortens the token counts, 1500 is shown as 1.5k.
+func formatTokens(tokens int) string {
+	switch {
+	case tokens < 1000:
+		return fmt.Sprint(tokens)
+	case tokens < 10000 && tokens%1000 >= 100:
+		return fmt.Sprintf("%.1fk", float64(tokens)/1000)
+	}
+
+	return fmt.Sprintf("%dk", tokens/1000)
+}
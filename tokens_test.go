@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"hi", 1},
+		{"hello world!", 3},
+		{"héllo", 2},
+	}
+
+	for _, tt := range tests {
+		got := estimateTokens(tt.input)
+
+		if got != tt.want {
+			t.Errorf("got %d want %d", got, tt.want)
+		}
+	}
+}
+
+func TestPromptBudget(t *testing.T) {
+	tests := []struct {
+		model  ModelInfo
+		params GenerationParams
+		want   int
+	}{
+		{ModelInfo{}, DefaultGenerationParams, DEFAULT_CONTEXT_WINDOW - DEFAULT_MAX_TOKENS},
+		{ModelInfo{ContextWindow: 128000, MaxPrompt: 64000, MaxOutput: 4096}, DefaultGenerationParams, 64000},
+		{ModelInfo{ContextWindow: 128000, MaxOutput: 16000}, DefaultGenerationParams, 112000},
+		{ModelInfo{ContextWindow: 128000, MaxOutput: 16000}, GenerationParams{MaxTokens: 1000}, 127000},
+		// The answer never takes more than half of the window
+		{ModelInfo{ContextWindow: 8000}, DefaultGenerationParams, 4000},
+	}
+
+	for _, tt := range tests {
+		got := promptBudget(tt.model, tt.params)
+
+		if got != tt.want {
+			t.Errorf("got %d want %d", got, tt.want)
+		}
+	}
+}
+
+func TestTruncateHistory(t *testing.T) {
+	// Every message is 10 tokens with the overhead
+	text := strings.Repeat("a", 24)
+
+	history := []HistoryMessage{
+		createSystemHistoryEntry(text),
+		createHistoryEntry(text),
+		createBotHistoryEntry(text),
+		createHistoryEntry(text),
+		createBotHistoryEntry(text),
+		createHistoryEntry(text),
+	}
+
+	tests := []struct {
+		budget  int
+		want    []string
+		dropped int
+	}{
+		{60, []string{"system", "user", "assistant", "user", "assistant", "user"}, 0},
+		{59, []string{"system", "user", "assistant", "user"}, 2},
+		{40, []string{"system", "user", "assistant", "user"}, 2},
+		{39, []string{"system", "user"}, 4},
+		// The last question is always sent
+		{5, []string{"system", "user"}, 4},
+	}
+
+	for _, tt := range tests {
+		got, dropped := truncateHistory(history, tt.budget)
+
+		roles := []string{}
+
+		for _, message := range got {
+			roles = append(roles, message.Role)
+		}
+
+		if strings.Join(roles, " ") != strings.Join(tt.want, " ") || dropped != tt.dropped {
+			t.Errorf("budget %d: got %v dropping %d want %v dropping %d", tt.budget, roles, dropped, tt.want, tt.dropped)
+		}
+	}
+
+	if len(history) != 6 {
+		t.Errorf("The history was modified")
+	}
+}
+
+func TestFormatTokens(t *testing.T) {
+	tests := []struct {
+		input int
+		want  string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1k"},
+		{1500, "1.5k"},
+		{2048, "2k"},
+		{16384, "16k"},
+		{128000, "128k"},
+	}
+
+	for _, tt := range tests {
+		got := formatTokens(tt.input)
+
+		if got != tt.want {
+			t.Errorf("got %s want %s", got, tt.want)
+		}
+	}
+}
+
+func TestUsageView(t *testing.T) {
+	switcher := &FakeSwitcher{model: ModelInfo{ID: "tiny", ContextWindow: 100, MaxOutput: 50}}
+	m := initialModel(switcher)
+
+	// The system prompt alone does not fit in the 50 tokens of the budget
+	m.history = append(m.history, createHistoryEntry("hi"), createBotHistoryEntry("hello"), createHistoryEntry("bye"))
+
+	got := m.usageView()
+
+	if !strings.Contains(got, "tiny · ") || !strings.Contains(got, "/50 tokens, 2 old messages left out") {
+		t.Errorf("got %s want the model, the usage and the dropped messages", got)
+	}
+
+	history, dropped := m.promptHistory()
+
+	if dropped != 2 || len(history) != 2 || history[1].Content != "bye" {
+		t.Errorf("got %v want the system prompt and the last question", history)
+	}
+}